@@ -0,0 +1,128 @@
+/* admin.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// adminFilter describes a filter in the responses of the admin handler.
+type adminFilter struct {
+	Logger string `json:"logger"`
+	Filter string `json:"filter"`
+	Level  string `json:"level"`
+	Writer string `json:"writer"`
+}
+
+type adminHandler struct {
+	log *Logger
+}
+
+// NewAdminHandler returns an http.Handler to inspect and change the filter
+// levels of log's hierarchy (the root logger and its named loggers) at
+// runtime, e.g. mux.Handle("/debug/log4go", log4go.NewAdminHandler(log4go.Global)).
+//
+// A GET request without parameters returns a JSON list of the filters with
+// their logger, level and LogWriter type.  A GET or PUT request with the
+// following parameters changes the level of a filter and returns the list:
+//   filter - the name of the filter
+//   level  - the new level (FINEST, FINE, DEBUG, TRACE, INFO, WARNING, ERROR, CRITICAL)
+//   logger - the named logger owning the filter (default: the root)
+//   revert - optional duration (e.g. "15m") after which the previous level is
+//            restored, unless the level has been changed again meanwhile
+func NewAdminHandler(log *Logger) http.Handler {
+	return &adminHandler{log.root()}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD", "PUT":
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.FormValue("filter") != "" || r.Method == "PUT" {
+		if status, err := h.setLevel(r); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.filters())
+}
+
+// Apply the level change described by the request parameters.
+func (h *adminHandler) setLevel(r *http.Request) (int, error) {
+	name, lvlName := r.FormValue("filter"), r.FormValue("level")
+	if name == "" || lvlName == "" {
+		return http.StatusBadRequest, fmt.Errorf("filter and level are required")
+	}
+	lvl, err := stringToLevel(strings.ToUpper(lvlName))
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("unknown level %q", lvlName)
+	}
+	var revert time.Duration
+	if s := r.FormValue("revert"); s != "" {
+		if revert, err = time.ParseDuration(s); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid revert duration %q: %s", s, err)
+		}
+	}
+
+	target := h.logger(r.FormValue("logger"))
+	if target == nil {
+		return http.StatusNotFound, fmt.Errorf("no logger %q", r.FormValue("logger"))
+	}
+	old, ok := target.swapLevel(name, nil, lvl)
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("no filter %q", name)
+	}
+	if revert > 0 {
+		time.AfterFunc(revert, func() {
+			target.swapLevel(name, &lvl, old)
+		})
+	}
+	return http.StatusOK, nil
+}
+
+// Return the existing logger with the given name, without creating it.
+func (h *adminHandler) logger(name string) *Logger {
+	if name == "" {
+		return h.log
+	}
+	for _, named := range h.log.Loggers() {
+		if named.name == name {
+			return named
+		}
+	}
+	return nil
+}
+
+// Describe the filters of the hierarchy, sorted by logger and filter name.
+func (h *adminHandler) filters() []adminFilter {
+	list := []adminFilter{}
+	for _, l := range append([]*Logger{h.log}, h.log.Loggers()...) {
+		start := len(list)
+		for name, filt := range l.Filters() {
+			list = append(list, adminFilter{
+				Logger: l.name,
+				Filter: name,
+				Level:  levelToString(filt.Level),
+				Writer: fmt.Sprintf("%T", filt.LogWriter),
+			})
+		}
+		named := list[start:]
+		sort.Slice(named, func(i, j int) bool { return named[i].Filter < named[j].Filter })
+	}
+	return list
+}
@@ -0,0 +1,128 @@
+/* caller.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Caller locates the code which logged a record.  The Callers of the call
+// sites are shared by their records and must not be modified.
+type Caller struct {
+	Function string // e.g. github.com/gojuno/log4go.(*Logger).Info
+	File     string // full path of the source file
+	Line     int
+
+	source string // as LogRecord.Source, "function:line"
+}
+
+// Return the Caller of frame.
+func newCaller(frame runtime.Frame) *Caller {
+	return &Caller{
+		Function: frame.Function,
+		File:     frame.File,
+		Line:     frame.Line,
+		source:   fmt.Sprintf("%s:%d", frame.Function, frame.Line),
+	}
+}
+
+// ShortFile returns the base name of the source file.
+func (c *Caller) ShortFile() string {
+	return filepath.Base(c.File)
+}
+
+// Package returns the import path of the package of the function.
+func (c *Caller) Package() string {
+	pkg, _ := c.split()
+	return pkg
+}
+
+// FuncName returns the name of the function within its package, e.g.
+// (*Logger).Info.
+func (c *Caller) FuncName() string {
+	_, name := c.split()
+	return name
+}
+
+// Split the function name after its package path.
+func (c *Caller) split() (pkg, name string) {
+	slash := strings.LastIndexByte(c.Function, '/') + 1
+	dot := strings.IndexByte(c.Function[slash:], '.')
+	if dot < 0 {
+		return "", c.Function
+	}
+	return c.Function[:slash+dot], c.Function[slash+dot+1:]
+}
+
+// String returns the caller as "function:line", like LogRecord.Source.
+func (c *Caller) String() string {
+	return c.source
+}
+
+// The Callers of the call sites logged from, by program counter
+var callers = struct {
+	sync.RWMutex
+	m map[uintptr]*Caller
+}{m: make(map[uintptr]*Caller)}
+
+// Return the Caller of the call site calldepth frames up, as for
+// runtime.Caller, or nil if there is none.  Unlike runtime.Caller this does
+// not allocate.
+func callerAt(calldepth int) *Caller {
+	var pcs [1]uintptr
+	if runtime.Callers(calldepth+1, pcs[:]) == 0 {
+		return nil
+	}
+	return callerOf(pcs[0])
+}
+
+// Return the Caller of the call site at pc, a return address as reported by
+// runtime.Callers, building it only the first time it logs.
+func callerOf(pc uintptr) *Caller {
+	callers.RLock()
+	c, ok := callers.m[pc]
+	callers.RUnlock()
+	if ok {
+		return c
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	c = newCaller(frame)
+	callers.Lock()
+	callers.m[pc] = c
+	callers.Unlock()
+	return c
+}
+
+// Return the ID of the calling goroutine, as shown in its stack traces.
+func goroutineID() uint64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	var id uint64
+	for _, c := range bytes.TrimPrefix(stack, []byte("goroutine ")) {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = 10*id + uint64(c-'0')
+	}
+	return id
+}
+
+// Facts about the process, written by the format codes
+var (
+	processStart = time.Now()
+	processID    = strconv.Itoa(os.Getpid())
+	processName  = filepath.Base(os.Args[0])
+	hostname, _  = os.Hostname()
+)
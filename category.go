@@ -0,0 +1,144 @@
+/* category.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"sort"
+	"strings"
+)
+
+/****** Named loggers ******/
+
+// GetLogger returns the logger with the given dotted name (e.g.
+// "payments.gateway") in the hierarchy rooted at log's root logger, creating
+// it and any missing ancestors ("payments") on first use.  The empty name
+// returns the root itself.
+//
+// A named logger has no filters of its own until some are added.  Records
+// logged through it are written by its own filters and then, while the
+// loggers passed through are additive, by the filters of its ancestors up to
+// the root.  If a category level has been set on the logger or its nearest
+// ancestor having one, records below that level are discarded before any
+// filter is consulted.  Records carry the logger name (format code %C).
+func (log *Logger) GetLogger(name string) *Logger {
+	root := log.root()
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return root
+	}
+
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	return root.getLogger(name)
+}
+
+// Look up or create a named logger below root.  root.mu must be held.
+func (root *Logger) getLogger(name string) *Logger {
+	if named, ok := root.loggers[name]; ok {
+		return named
+	}
+
+	parent := root
+	if i := strings.LastIndex(name, "."); i > 0 {
+		parent = root.getLogger(name[:i])
+	}
+	named := &Logger{name: name, parent: parent}
+	if root.loggers == nil {
+		root.loggers = make(map[string]*Logger)
+	}
+	root.loggers[name] = named
+	return named
+}
+
+// Loggers returns the named loggers created below log's root so far, sorted
+// by name.
+func (log *Logger) Loggers() []*Logger {
+	root := log.root()
+	root.mu.RLock()
+	loggers := make([]*Logger, 0, len(root.loggers))
+	for _, named := range root.loggers {
+		loggers = append(loggers, named)
+	}
+	root.mu.RUnlock()
+
+	sort.Slice(loggers, func(i, j int) bool { return loggers[i].name < loggers[j].name })
+	return loggers
+}
+
+// Return the root of log's hierarchy.
+func (log *Logger) root() *Logger {
+	for log.parent != nil {
+		log = log.parent
+	}
+	return log
+}
+
+// Name returns the dotted name of the logger, or "" for a root logger.
+func (log *Logger) Name() string {
+	return log.name
+}
+
+// Parent returns the parent of a named logger, or nil for a root logger.
+func (log *Logger) Parent() *Logger {
+	return log.parent
+}
+
+// SetCategoryLevel discards records below lvl logged through this logger and
+// those of its descendants which have no category level of their own.
+func (log *Logger) SetCategoryLevel(lvl Level) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.level, log.hasLevel = lvl, true
+}
+
+// ClearCategoryLevel removes the category level of this logger, so that it
+// inherits the level of its nearest ancestor having one.
+func (log *Logger) ClearCategoryLevel() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.hasLevel = false
+}
+
+// CategoryLevel returns the category level set on this logger, if any.
+func (log *Logger) CategoryLevel() (lvl Level, ok bool) {
+	log.mu.RLock()
+	defer log.mu.RUnlock()
+	return log.level, log.hasLevel
+}
+
+// EffectiveLevel returns the category level of this logger or of its nearest
+// ancestor having one.  If ok is false, no category level applies and only
+// the filter levels decide what is written.
+func (log *Logger) EffectiveLevel() (lvl Level, ok bool) {
+	for l := log; l != nil; l = l.parent {
+		if lvl, ok = l.CategoryLevel(); ok {
+			return
+		}
+	}
+	return
+}
+
+// SetAdditivity controls whether records logged through this logger are also
+// passed to the filters of its parent (the default) or only to its own.
+func (log *Logger) SetAdditivity(additive bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.nonAdditive = !additive
+}
+
+// Additivity reports whether records are passed on to the parent's filters.
+func (log *Logger) Additivity() bool {
+	log.mu.RLock()
+	defer log.mu.RUnlock()
+	return !log.nonAdditive
+}
+
+// Restore the default category settings of a named logger.
+func (log *Logger) resetCategory() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.hasLevel, log.nonAdditive = false, false
+}
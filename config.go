@@ -13,18 +13,46 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type FilterItem struct {
 	Enabled    bool
 	Tag        string
-	Level      level
+	Level      Level
 	Type       LoggerType
+	Category   string    // name of the logger to attach the filter to ("" for the root)
+	Match      Predicate // records written in addition to the level, nil for all
 	Properties map[PropertyName]interface{}
 }
 
+// MatchItem holds the record selection options of a filter configuration,
+// given next to its level.  Empty options are ignored.
+type MatchItem struct {
+	MaxLevel       string // highest level written
+	Source         string // glob the source must match, see MatchSource
+	Message        string // regular expression the message must match
+	ExcludeSource  string // glob of sources not written
+	ExcludeMessage string // regular expression of messages not written
+}
+
+// CategoryItem configures a named logger (see GetLogger).
+type CategoryItem struct {
+	Name     string
+	Level    Level
+	HasLevel bool // false leaves the level to be inherited
+	Additive bool
+}
+
+// The writers buffering records, see recordQueue
+type queuedLogWriter interface {
+	SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration)
+	SetDropReport(report bool)
+}
+
 type LoggerCfg struct {
-	Filters []*FilterItem
+	Filters    []*FilterItem
+	Categories []*CategoryItem
 }
 
 func (fi *FilterItem) getString(p PropertyName) string {
@@ -35,6 +63,14 @@ func (fi *FilterItem) getInt(p PropertyName) int {
 	return fi.getProperty(p).(int)
 }
 
+func (fi *FilterItem) getLevel(p PropertyName) Level {
+	return fi.getProperty(p).(Level)
+}
+
+func (fi *FilterItem) getDuration(p PropertyName) time.Duration {
+	return fi.getProperty(p).(time.Duration)
+}
+
 func (fi *FilterItem) getBool(p PropertyName) bool {
 	return fi.getProperty(p).(bool)
 }
@@ -52,7 +88,7 @@ func (fi *FilterItem) getProperty(p PropertyName) interface{} {
 		}
 	case FORMAT:
 		if !ok {
-			v = "[%D %T] [%L] (%S) %M"
+			v = FORMAT_DEFAULT
 		}
 	case MAX_LINES:
 		if !ok {
@@ -74,12 +110,117 @@ func (fi *FilterItem) getProperty(p PropertyName) interface{} {
 		if !ok {
 			v = false
 		}
+	case STACK_LEVEL:
+		if !ok {
+			v = DefaultStackLevel
+		}
+	case SAMPLE_FIRST:
+		if !ok {
+			v = 0
+		}
+	case SAMPLE_THEREAFTER:
+		if !ok {
+			v = 0
+		}
+	case SAMPLE_INTERVAL:
+		if !ok {
+			v = time.Second
+		}
+	case OVERFLOW:
+		if !ok {
+			v = OVERFLOW_BLOCK
+		}
+	case OVERFLOW_TIMEOUT:
+		if !ok {
+			v = time.Second
+		}
+	case DROP_REPORT:
+		if !ok {
+			v = false
+		}
+	case RING_TARGET:
+		if !ok {
+			v = CONSOLE
+		}
+	case RING_SIZE:
+		if !ok {
+			v = 1000
+		}
+	case RING_TRIGGER:
+		if !ok {
+			v = ERROR
+		}
 		// default:
 		// 	err = Error{Message: fmt.Sprintf("Unknown property \"%s=%s\"", p, v)}
 	}
 	return v
 }
 
+func newCategoryCfg(name string, lvl string, additive bool) (*CategoryItem, error) {
+	c := CategoryItem{
+		Name:     name,
+		Additive: additive,
+	}
+	if lvl == "" {
+		return &c, nil
+	}
+
+	l, err := stringToLevel(lvl)
+	if err != nil {
+		return nil, configurationFieldError{
+			"could not parse category level",
+			"level",
+			lvl,
+			err,
+		}
+	}
+	c.Level, c.HasLevel = l, true
+	return &c, nil
+}
+
+// Build the Predicate selecting the records described by mi, nil if it selects
+// all records.
+func newMatchCfg(mi MatchItem) (Predicate, error) {
+	var preds []Predicate
+	if mi.MaxLevel != "" {
+		l, err := stringToLevel(mi.MaxLevel)
+		if err != nil {
+			return nil, configurationFieldError{"could not parse maximum level", "maxlevel", mi.MaxLevel, err}
+		}
+		preds = append(preds, LevelRange(FINEST, l))
+	}
+	for _, opt := range []struct {
+		field, value string
+		build        func(string) (Predicate, error)
+		exclude      bool
+	}{
+		{"source", mi.Source, MatchSource, false},
+		{"message", mi.Message, MatchMessage, false},
+		{"excludesource", mi.ExcludeSource, MatchSource, true},
+		{"excludemessage", mi.ExcludeMessage, MatchMessage, true},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		p, err := opt.build(opt.value)
+		if err != nil {
+			return nil, configurationFieldError{"could not parse " + opt.field, opt.field, opt.value, err}
+		}
+		if opt.exclude {
+			p = Not(p)
+		}
+		preds = append(preds, p)
+	}
+
+	switch len(preds) {
+	case 0:
+		return nil, nil
+	case 1:
+		return preds[0], nil
+	}
+	return All(preds...), nil
+}
+
 func loadFile(filename string) ([]byte, error) {
 	fd, err := os.Open(filename)
 	if err != nil {
@@ -93,60 +234,147 @@ func loadFile(filename string) ([]byte, error) {
 	return contents, nil
 }
 
-// Load XML configuration; see examples/example.xml for documentation
-func (log Logger) ApplyConfiguration(lc *LoggerCfg) error {
+// Load XML configuration; see examples/example.xml for documentation.  Stops at
+// the first writer which cannot be created and returns its failure.
+func (log *Logger) ApplyConfiguration(lc *LoggerCfg) error {
 	var filter LogWriter
 	for _, fi := range lc.Filters {
 		if !fi.Enabled {
 			continue
 		}
-		switch fi.Type {
+		// A ring writer keeps the records for a writer of its target type,
+		// built from the same properties
+		lType := fi.Type
+		if lType == RING {
+			lType = fi.getProperty(RING_TARGET).(LoggerType)
+		}
+		var err error
+		switch lType {
 		case CONSOLE:
-			filter = getConsoleLogWriter(fi)
+			filter = getConsoleLogWriter(fi, log.filterPattern(fi))
 		case FILE:
-			filter = getFileLogWriter(fi)
+			filter, err = getFileLogWriter(fi, log.filterPattern(fi))
 		case XML:
-			filter = getXmlLogWriter(fi)
+			filter, err = getXmlLogWriter(fi, log.filterPattern(fi))
 		case SOCKET:
-			filter = NewSocketLogWriter(fi.getString(PROTOCOL), fi.getString(ENDPOINT))
+			filter, err = getSocketLogWriter(fi)
+		}
+		if err != nil {
+			return err
+		}
+		if qw, ok := filter.(queuedLogWriter); ok {
+			qw.SetOverflowPolicy(fi.getProperty(OVERFLOW).(OverflowPolicy), fi.getDuration(OVERFLOW_TIMEOUT))
+			qw.SetDropReport(fi.getBool(DROP_REPORT))
+		}
+		if fi.Type == RING {
+			filter = NewRingLogWriter(filter, fi.getInt(RING_SIZE), fi.getLevel(RING_TRIGGER))
+		}
+		filter = getSamplingLogWriter(fi, filter)
+		if _, ok := fi.Properties[DEDUP]; ok {
+			filter = NewDedupLogWriter(filter, fi.getDuration(DEDUP))
 		}
 
-		log[fi.Tag] = &Filter{fi.Level, filter}
+		target := log
+		if fi.Category != "" {
+			target = log.GetLogger(fi.Category)
+		}
+		// Install the filter complete, so no record reaches it unmatched
+		target.setFilter(fi.Tag, &Filter{
+			Level:      fi.Level,
+			StackLevel: fi.getLevel(STACK_LEVEL),
+			Match:      fi.Match,
+			LogWriter:  filter,
+		})
+	}
+	for _, ci := range lc.Categories {
+		named := log.GetLogger(ci.Name)
+		if ci.HasLevel {
+			named.SetCategoryLevel(ci.Level)
+		} else {
+			named.ClearCategoryLevel()
+		}
+		named.SetAdditivity(ci.Additive)
 	}
 	return nil
 }
 
-func getConsoleLogWriter(fi *FilterItem) LogWriter {
+// Compile the format of the filter item.  As with SetFormat, an invalid format
+// is reported to the ErrorHandler and its invalid codes are ignored.
+func (log *Logger) filterPattern(fi *FilterItem) *Pattern {
+	p, err := compilePattern(fi.getString(FORMAT))
+	if err != nil {
+		log.handleError(&WriterError{Writer: "LoadConfiguration", Op: "format", Err: err})
+	}
+	return p
+}
+
+func getConsoleLogWriter(fi *FilterItem, pattern *Pattern) LogWriter {
 	clw := NewConsoleLogWriter()
-	clw.SetFormat(fi.getString(FORMAT))
+	clw.SetPattern(pattern)
 	return clw
 }
 
-func getFileLogWriter(fi *FilterItem) LogWriter {
-	flw := NewFileLogWriter(fi.getString(FILENAME), fi.getBool(ROTATE))
-	flw.SetFormat(fi.getString(FORMAT))
+func getFileLogWriter(fi *FilterItem, pattern *Pattern) (LogWriter, error) {
+	flw, err := newFileLogWriter(fi.getString(FILENAME), fi.getBool(ROTATE))
+	if err != nil {
+		return nil, err
+	}
+	flw.SetPattern(pattern)
 	flw.SetRotateLines(fi.getInt(MAX_LINES))
 	flw.SetRotateSize(fi.getInt(MAX_SIZE))
 	flw.SetRotateDaily(fi.getBool(DAILY))
-	return flw
+	return flw, nil
 }
 
-func getXmlLogWriter(fi *FilterItem) LogWriter {
-	xlw := NewXMLLogWriter(fi.getString(FILENAME), fi.getBool(ROTATE))
-	xlw.SetFormat(fi.getString(FORMAT))
+func getXmlLogWriter(fi *FilterItem, pattern *Pattern) (LogWriter, error) {
+	xlw, err := newFileLogWriter(fi.getString(FILENAME), fi.getBool(ROTATE))
+	if err != nil {
+		return nil, err
+	}
+	xlw.setXML().SetPattern(pattern)
 	xlw.SetRotateLines(fi.getInt(MAX_LINES))
 	xlw.SetRotateSize(fi.getInt(MAX_SIZE))
 	xlw.SetRotateDaily(fi.getBool(DAILY))
 
-	return xlw
+	return xlw, nil
+}
+
+func getSocketLogWriter(fi *FilterItem) (LogWriter, error) {
+	slw, err := newSocketLogWriter(fi.getString(PROTOCOL), fi.getString(ENDPOINT))
+	if err != nil {
+		return nil, err
+	}
+	return slw, nil
+}
+
+// Wrap filter in a SamplingLogWriter if the filter item sets sampling properties
+func getSamplingLogWriter(fi *FilterItem, filter LogWriter) LogWriter {
+	_, first := fi.Properties[SAMPLE_FIRST]
+	_, thereafter := fi.Properties[SAMPLE_THEREAFTER]
+	if !first && !thereafter {
+		return filter
+	}
+	return NewSamplingLogWriter(filter, fi.getInt(SAMPLE_FIRST), fi.getInt(SAMPLE_THEREAFTER), fi.getDuration(SAMPLE_INTERVAL))
+}
+
+// Report a failure to load a configuration to the ErrorHandler and return it.
+func (log *Logger) configError(err error) error {
+	log.handleError(&WriterError{Writer: "LoadConfiguration", Op: "config", Err: err})
+	return err
 }
 
-// Load XML configuration; see examples/example.xml for documentation
+// Load XML configuration; see examples/example.xml for documentation.  An
+// invalid configuration is reported to the ErrorHandler and ends the program,
+// see SetTerminationPolicy.
 func (log *Logger) LoadConfiguration(filename string) {
 	log.Close()
 	// Open the configuration file
 	contents, err := loadFile(filename)
-	checkFatalError(err)
+	if err != nil {
+		log.configError(err)
+		log.fatalError()
+		return
+	}
 
 	ext := filepath.Ext(filename)
 	switch ext {
@@ -155,7 +383,9 @@ func (log *Logger) LoadConfiguration(filename string) {
 	case ".yaml":
 		err = log.loadYamlConfiguration(contents)
 	default:
-		checkFatalError(internalError{Message: "unknown filename extention [" + ext + "]"})
+		err = log.configError(internalError{Message: "unknown filename extention [" + ext + "]"})
+	}
+	if err != nil {
+		log.fatalError()
 	}
-	checkFatalError(err)
 }
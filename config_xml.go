@@ -19,15 +19,28 @@ type xmlProperty struct {
 }
 
 type xmlFilter struct {
-	Enabled  string        `xml:"enabled,attr"`
-	Tag      string        `xml:"tag"`
-	Level    string        `xml:"level"`
-	Type     string        `xml:"type"`
-	Property []xmlProperty `xml:"property"`
+	Enabled        string        `xml:"enabled,attr"`
+	Tag            string        `xml:"tag"`
+	Level          string        `xml:"level"`
+	MaxLevel       string        `xml:"maxlevel"`
+	Source         string        `xml:"source"`
+	Message        string        `xml:"message"`
+	ExcludeSource  string        `xml:"excludesource"`
+	ExcludeMessage string        `xml:"excludemessage"`
+	Type           string        `xml:"type"`
+	Category       string        `xml:"category"`
+	Property       []xmlProperty `xml:"property"`
+}
+
+type xmlCategory struct {
+	Name       string `xml:"name,attr"`
+	Additivity string `xml:"additivity,attr"`
+	Level      string `xml:"level"`
 }
 
 type xmlLoggerConfig struct {
-	Filter []xmlFilter `xml:"filter"`
+	Filter   []xmlFilter   `xml:"filter"`
+	Category []xmlCategory `xml:"category"`
 }
 
 func xmlNewFilterCfg(enabled string, tag string, fType string, lvl string) (*FilterItem, error) {
@@ -69,6 +82,17 @@ func xmlToConfiguration(xc *xmlLoggerConfig) (*LoggerCfg, error) {
 		if err != nil {
 			return nil, err
 		}
+		f.Category = xmlfilt.Category
+		f.Match, err = newMatchCfg(MatchItem{
+			MaxLevel:       xmlfilt.MaxLevel,
+			Source:         xmlfilt.Source,
+			Message:        xmlfilt.Message,
+			ExcludeSource:  xmlfilt.ExcludeSource,
+			ExcludeMessage: xmlfilt.ExcludeMessage,
+		})
+		if err != nil {
+			return nil, err
+		}
 
 		lc.Filters = append(lc.Filters, f)
 		for _, p := range xmlfilt.Property {
@@ -84,6 +108,13 @@ func xmlToConfiguration(xc *xmlLoggerConfig) (*LoggerCfg, error) {
 
 		}
 	}
+	for _, xmlcat := range xc.Category {
+		c, err := newCategoryCfg(xmlcat.Name, xmlcat.Level, xmlcat.Additivity != "false")
+		if err != nil {
+			return nil, err
+		}
+		lc.Categories = append(lc.Categories, c)
+	}
 	return lc, nil
 }
 
@@ -95,18 +126,17 @@ func (log *Logger) loadXmlConfiguration(contents []byte) error {
 
 	err := xml.Unmarshal(contents, xc)
 	if err != nil {
-		// fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse XML configuration in %q: %s\n", filename, err)
-		return err
+		return log.configError(err)
 	}
 
 	lc, err := xmlToConfiguration(xc)
 	if err != nil {
-		return err
+		return log.configError(err)
 	}
 
 	err = log.ApplyConfiguration(lc)
 	if err != nil {
-		return err
+		return log.configError(err)
 	}
 	return nil
 }
@@ -9,8 +9,6 @@
 package log4go
 
 import (
-	"fmt"
-	"os"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -19,14 +17,26 @@ import (
 type yamlFilterProperties map[string]string
 
 type yamlFilter struct {
-	Enabled    bool                 "enabled"
-	Type       string               "type"
-	Level      string               "level"
-	Properties yamlFilterProperties ",flow"
+	Enabled        bool                 `yaml:"enabled"`
+	Type           string               `yaml:"type"`
+	Level          string               `yaml:"level"`
+	MaxLevel       string               `yaml:"maxlevel"`
+	Source         string               `yaml:"source"`
+	Message        string               `yaml:"message"`
+	ExcludeSource  string               `yaml:"excludesource"`
+	ExcludeMessage string               `yaml:"excludemessage"`
+	Category       string               `yaml:"category"`
+	Properties     yamlFilterProperties `yaml:",flow"`
+}
+
+type yamlCategory struct {
+	Level      string `yaml:"level"`
+	Additivity *bool  `yaml:"additivity"`
 }
 
 type yamlLoggerConfig struct {
-	Logging map[string]yamlFilter ",flow"
+	Logging    map[string]yamlFilter   `yaml:",flow"`
+	Categories map[string]yamlCategory `yaml:"-"`
 }
 
 func unmarshalYamlSible(contents []byte, startWith string) (*yamlLoggerConfig, error) {
@@ -38,7 +48,6 @@ func unmarshalYamlSible(contents []byte, startWith string) (*yamlLoggerConfig, e
 
 	m := map[interface{}]interface{}{}
 	if err := yaml.Unmarshal(contents, &m); err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse YAML configuration: %s\n", err)
 		return nil, err
 	}
 
@@ -56,18 +65,46 @@ func unmarshalYamlSible(contents []byte, startWith string) (*yamlLoggerConfig, e
 
 	r, err := yaml.Marshal(map[interface{}]interface{}{key: value})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse YAML configuration: %s\n", err)
 		return nil, err
 	}
 
 	yc := new(yamlLoggerConfig)
 	if err := yaml.Unmarshal(r, yc); err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse YAML configuration: %s\n", err)
 		return nil, err
 	}
 	return yc, nil
 }
 
+// Read the named loggers configuration found at path, if there is one.
+func unmarshalYamlCategories(contents []byte, path string) (map[string]yamlCategory, error) {
+	m := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(contents, &m); err != nil {
+		return nil, err
+	}
+
+	var value interface{} = m
+	for _, k := range strings.Split(path, ".") {
+		node, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = node[k]
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	r, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	categories := map[string]yamlCategory{}
+	if err := yaml.Unmarshal(r, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
 func yamlNewFilterCfg(enabled bool, tag string, fType string, lvl string, properties yamlFilterProperties) (*FilterItem, error) {
 	f := FilterItem{
 		Enabled:    enabled,
@@ -119,8 +156,26 @@ func yamlToConfiguration(yc *yamlLoggerConfig) (*LoggerCfg, error) {
 		if err != nil {
 			return nil, err
 		}
+		f.Category = desc.Category
+		f.Match, err = newMatchCfg(MatchItem{
+			MaxLevel:       desc.MaxLevel,
+			Source:         desc.Source,
+			Message:        desc.Message,
+			ExcludeSource:  desc.ExcludeSource,
+			ExcludeMessage: desc.ExcludeMessage,
+		})
+		if err != nil {
+			return nil, err
+		}
 		lc.Filters = append(lc.Filters, f)
 	}
+	for name, desc := range yc.Categories {
+		c, err := newCategoryCfg(name, desc.Level, desc.Additivity == nil || *desc.Additivity)
+		if err != nil {
+			return nil, err
+		}
+		lc.Categories = append(lc.Categories, c)
+	}
 	return lc, nil
 }
 
@@ -129,20 +184,22 @@ func (log *Logger) loadYamlConfiguration(contents []byte) error {
 	// TODO: replace errors to typed
 	yc, err := unmarshalYamlSible(contents, YamlConfigRoot)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[log4go] unmarshalYamlSible error\n")
-		return err
+		return log.configError(err)
+	}
+
+	yc.Categories, err = unmarshalYamlCategories(contents, YamlCategoriesRoot)
+	if err != nil {
+		return log.configError(err)
 	}
 
 	lc, err := yamlToConfiguration(yc)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[log4go] yamlToConfiguration error\n")
-		return err
+		return log.configError(err)
 	}
 
 	err = log.ApplyConfiguration(lc)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[log4go] ApplyConfiguration error\n")
-		return err
+		return log.configError(err)
 	}
 	return nil
 }
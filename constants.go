@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type LoggerType int
@@ -21,6 +22,7 @@ const (
 	FILE
 	XML
 	SOCKET
+	RING
 )
 
 type PropertyName int
@@ -35,26 +37,29 @@ const (
 	DAILY
 	ENDPOINT
 	PROTOCOL
+	STACK_LEVEL
+	SAMPLE_FIRST
+	SAMPLE_THEREAFTER
+	SAMPLE_INTERVAL
+	DEDUP
+	OVERFLOW
+	OVERFLOW_TIMEOUT
+	DROP_REPORT
+	RING_TARGET
+	RING_SIZE
+	RING_TRIGGER
 )
 
-var loggingLevels = newEnumMap()
 var loggerTypes = newEnumMap()
 var properties = newEnumMap()
+var overflowPolicies = newEnumMap()
 
 func init() {
-	loggingLevels.put(FINEST, "FINEST")
-	loggingLevels.put(FINE, "FINE")
-	loggingLevels.put(DEBUG, "DEBUG")
-	loggingLevels.put(TRACE, "TRACE")
-	loggingLevels.put(INFO, "INFO")
-	loggingLevels.put(WARNING, "WARNING")
-	loggingLevels.put(ERROR, "ERROR")
-	loggingLevels.put(CRITICAL, "CRITICAL")
-
 	loggerTypes.put(CONSOLE, "console")
 	loggerTypes.put(FILE, "file")
 	loggerTypes.put(XML, "xml")
 	loggerTypes.put(SOCKET, "socket")
+	loggerTypes.put(RING, "ring")
 
 	properties.put(FILENAME, "filename")
 	properties.put(ROTATE, "rotate")
@@ -65,21 +70,36 @@ func init() {
 	properties.put(DAILY, "daily")
 	properties.put(ENDPOINT, "endpoint")
 	properties.put(PROTOCOL, "protocol")
+	properties.put(STACK_LEVEL, "stacklevel")
+	properties.put(SAMPLE_FIRST, "samplefirst")
+	properties.put(SAMPLE_THEREAFTER, "samplethereafter")
+	properties.put(SAMPLE_INTERVAL, "sampleinterval")
+	properties.put(DEDUP, "dedup")
+	properties.put(OVERFLOW, "overflow")
+	properties.put(OVERFLOW_TIMEOUT, "overflowtimeout")
+	properties.put(DROP_REPORT, "dropreport")
+	properties.put(RING_TARGET, "target")
+	properties.put(RING_SIZE, "ringsize")
+	properties.put(RING_TRIGGER, "trigger")
+
+	overflowPolicies.put(OVERFLOW_BLOCK, "block")
+	overflowPolicies.put(OVERFLOW_DROP_NEWEST, "dropnewest")
+	overflowPolicies.put(OVERFLOW_DROP_OLDEST, "dropoldest")
+	overflowPolicies.put(OVERFLOW_BLOCK_TIMEOUT, "blocktimeout")
 }
 
-func stringToLevel(levelString string) (lvl level, err error) {
-	lvl = DEBUG
-	err = nil
-
-	v, ok := loggingLevels.name(levelString)
-	if !ok {
+func stringToLevel(levelString string) (lvl Level, err error) {
+	lvl, err = ParseLevel(levelString)
+	if err != nil {
 		err = internalError{Message: levelString}
-	} else {
-		lvl = v.(level)
 	}
 	return
 }
 
+func levelToString(lvl Level) string {
+	return lvl.Name()
+}
+
 func stringToType(typeString string) (lType LoggerType, err error) {
 	lType = CONSOLE
 	err = nil
@@ -150,8 +170,42 @@ func stringToPropertyValue(p PropertyName, v string) (value interface{}, err err
 		value = v
 	case PROTOCOL:
 		value = v
+	case STACK_LEVEL:
+		if v == "NONE" {
+			value = STACK_NONE
+		} else {
+			value, err = stringToLevel(v)
+		}
+	case SAMPLE_FIRST:
+		value = strToNumSuffix(v, 1000)
+	case SAMPLE_THEREAFTER:
+		value = strToNumSuffix(v, 1000)
+	case SAMPLE_INTERVAL:
+		value, err = time.ParseDuration(v)
+	case DEDUP:
+		value, err = time.ParseDuration(v)
+	case OVERFLOW:
+		if policy, ok := overflowPolicies.name(v); ok {
+			value = policy
+		} else {
+			err = internalError{Message: fmt.Sprintf("Unknown overflow policy \"%s\"", v)}
+		}
+	case OVERFLOW_TIMEOUT:
+		value, err = time.ParseDuration(v)
+	case DROP_REPORT:
+		value = v != "false"
+	case RING_TARGET:
+		value, err = stringToType(v)
+		if err == nil && value == RING {
+			err = internalError{Message: "a ring writer cannot target a ring writer"}
+		}
+	case RING_SIZE:
+		value = strToNumSuffix(v, 1000)
+	case RING_TRIGGER:
+		value, err = stringToLevel(v)
 	default:
-		err = internalError{Message: fmt.Sprintf("Unknown property \"%s=%s\"", p, v)}
+		name, _ := properties.value(p)
+		err = internalError{Message: fmt.Sprintf("Unknown property \"%v=%s\"", name, v)}
 	}
 
 	return
@@ -0,0 +1,75 @@
+/* context.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"context"
+	"sync"
+)
+
+// A ContextExtractor returns the fields which should be attached to a record
+// logged with ctx, e.g. the request or trace ID stored there by middleware.
+// It is only called for records which will be written, and may return nil.
+type ContextExtractor func(ctx context.Context) Fields
+
+var contextExtractors struct {
+	sync.RWMutex
+	list []ContextExtractor
+}
+
+func init() {
+	RegisterContextExtractor(FieldsFromContext)
+}
+
+// RegisterContextExtractor adds fn to the extractors consulted by the *Ctx
+// logging methods.  Extractors run in the order they were registered and their
+// fields are appended to the record after the logger's own fields.
+func RegisterContextExtractor(fn ContextExtractor) {
+	contextExtractors.Lock()
+	defer contextExtractors.Unlock()
+	// Copy on write: contextFields reads the list without holding the lock
+	list := make([]ContextExtractor, 0, len(contextExtractors.list)+1)
+	contextExtractors.list = append(append(list, contextExtractors.list...), fn)
+}
+
+// ContextValueExtractor returns a ContextExtractor which stores ctx.Value(key)
+// in the field name, if the context holds a non-nil value for key.
+func ContextValueExtractor(name string, key interface{}) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		if v := ctx.Value(key); v != nil {
+			return Fields{{name, v}}
+		}
+		return nil
+	}
+}
+
+// Collect the fields of all registered extractors for ctx.
+func contextFields(ctx context.Context) (fields Fields) {
+	contextExtractors.RLock()
+	list := contextExtractors.list
+	contextExtractors.RUnlock()
+
+	for _, fn := range list {
+		fields = fields.concat(fn(ctx))
+	}
+	return
+}
+
+type contextFieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying the given alternating keys
+// and values in addition to any fields already stored in ctx.  They are
+// attached to every record logged with the returned context.
+func ContextWithFields(ctx context.Context, kv ...interface{}) context.Context {
+	return context.WithValue(ctx, contextFieldsKey{}, FieldsFromContext(ctx).concat(kvToFields(kv)))
+}
+
+// FieldsFromContext returns the fields stored in ctx by ContextWithFields.
+// It is registered as a ContextExtractor by default.
+func FieldsFromContext(ctx context.Context) Fields {
+	fields, _ := ctx.Value(contextFieldsKey{}).(Fields)
+	return fields
+}
@@ -0,0 +1,121 @@
+/* dedup.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// This log writer collapses consecutive identical records (same level, source
+// and message) passed to another LogWriter, like syslogd: the first record is
+// written and the repetitions are counted, then a "last message repeated N
+// times" record is written when a different record arrives or when the
+// repetitions have been held for the timeout.
+type DedupLogWriter struct {
+	wrappedWriter
+	timeout time.Duration
+
+	mu      sync.Mutex
+	last    *LogRecord // last record written, retained
+	repeats int        // repetitions of last held
+	batch   int        // number of summaries written, to ignore stale timers
+	timer   *time.Timer
+	closed  bool
+}
+
+// NewDedupLogWriter wraps writer to collapse repeated records, holding the
+// repetitions at most timeout (one minute if 0) before reporting them.
+func NewDedupLogWriter(writer LogWriter, timeout time.Duration) *DedupLogWriter {
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	return &DedupLogWriter{
+		// The source is compared to detect repetitions
+		wrappedWriter: wrappedWriter{writer: writer, parts: PART_SOURCE},
+		timeout:       timeout,
+	}
+}
+
+// This is the DedupLogWriter's output method
+func (w *DedupLogWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if last := w.last; last != nil && last.Level == rec.Level && last.Source == rec.Source && last.Message == rec.Message {
+		if w.repeats == 0 {
+			batch := w.batch
+			w.timer = time.AfterFunc(w.timeout, func() { w.timedOut(batch) })
+		}
+		w.repeats++
+		rec.Release()
+		return
+	}
+
+	w.flush(rec.Created)
+	if w.last != nil {
+		w.last.Release()
+	}
+	w.last = rec
+	rec.Retain() // one reference kept as last, the other passed on
+	w.writer.LogWrite(rec)
+}
+
+func (w *DedupLogWriter) timedOut(batch int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed && batch == w.batch {
+		w.flush(time.Now())
+	}
+}
+
+// Write the summary of the held repetitions, if any.  Must be called with mu
+// held.
+func (w *DedupLogWriter) flush(now time.Time) {
+	if w.repeats == 0 {
+		return
+	}
+	w.timer.Stop()
+
+	msg := "last message repeated once"
+	if w.repeats > 1 {
+		msg = fmt.Sprintf("last message repeated %d times", w.repeats)
+	}
+	w.writer.LogWrite(&LogRecord{
+		Level:   w.last.Level,
+		Created: now,
+		Source:  w.last.Source,
+		Message: msg,
+		Logger:  w.last.Logger,
+	})
+	w.repeats = 0
+	w.batch++
+}
+
+// Close writes the summary of the held repetitions and closes the wrapped
+// LogWriter.
+func (w *DedupLogWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush(time.Now())
+	w.closed = true
+	if w.last != nil {
+		w.last.Release()
+		w.last = nil
+	}
+	w.writer.Close()
+}
+
+// Flush writes the summary of the held repetitions and flushes the wrapped
+// LogWriter, if it is a Flusher.
+func (w *DedupLogWriter) Flush() {
+	w.mu.Lock()
+	w.flush(time.Now())
+	w.mu.Unlock()
+
+	w.wrappedWriter.Flush()
+}
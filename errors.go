@@ -40,12 +40,35 @@ type configurationFieldError struct {
 }
 
 func (e configurationFieldError) Error() string {
-	return fmt.Sprintf("error: [%s]: %s=%s]", e.Message, e.FieldName, e.Value, e.Err)
+	return fmt.Sprintf("error: [%s]: %s=%s [%s]", e.Message, e.FieldName, e.Value, e.Err)
 }
 
-func checkFatalError(err error) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
-		os.Exit(1)
-	}
+// WriterError describes a failure of a LogWriter (or of loading a
+// configuration), as passed to an ErrorHandler.
+type WriterError struct {
+	Writer string     // the failing writer, e.g. FileLogWriter("app.log")
+	Op     string     // the failed operation: "open", "rotate", "write", "sync", "dial", "marshal", "format", "config"
+	Err    error      // the underlying error
+	Record *LogRecord // the record being written, if any
+}
+
+func (e *WriterError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Writer, e.Err)
+}
+
+// An ErrorHandler is called with the failures of LogWriters, which usually
+// stop writing after one.  It may be called concurrently from the writers'
+// goroutines.
+type ErrorHandler func(err *WriterError)
+
+// DefaultErrorHandler handles the errors of writers for which neither the
+// writer nor its Logger has an ErrorHandler, and the errors of writers failing
+// before they are added to a Logger.  It prints them to standard error.
+var DefaultErrorHandler ErrorHandler = func(err *WriterError) {
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+}
+
+// The LogWriters accepting the ErrorHandler of the Logger they are added to
+type errorHandlerSetter interface {
+	setLoggerErrorHandler(h ErrorHandler)
 }
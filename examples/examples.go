@@ -16,7 +16,7 @@ import (
 	"os"
 	"time"
 
-	l4g "github.com/mguzelevich/log4go"
+	l4g "github.com/gojuno/log4go"
 )
 
 const (
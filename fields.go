@@ -0,0 +1,289 @@
+/* fields.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/****** Fields ******/
+
+// A Field is a single key/value pair attached to a LogRecord.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields is an ordered list of key/value pairs carried by a LogRecord.
+type Fields []Field
+
+// Key used for a trailing value which has no key of its own.
+const badKey = "!BADKEY"
+
+// Build Fields from alternating keys and values, e.g. ("user", 42, "ip", addr).
+// Keys which are not strings are converted with fmt.Sprint; a trailing value
+// without a key is stored under "!BADKEY".
+func kvToFields(kv []interface{}) Fields {
+	if len(kv) == 0 {
+		return nil
+	}
+	fields := make(Fields, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 == len(kv) {
+			fields = append(fields, Field{badKey, kv[i]})
+			break
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		fields = append(fields, Field{key, kv[i+1]})
+	}
+	return fields
+}
+
+// Return a new list holding the fields of f followed by more.  Neither f nor
+// more are modified, so the result may be handed to asynchronous writers.
+func (f Fields) concat(more Fields) Fields {
+	switch {
+	case len(more) == 0:
+		return f
+	case len(f) == 0:
+		return more
+	}
+	out := make(Fields, 0, len(f)+len(more))
+	return append(append(out, f...), more...)
+}
+
+// Write the fields as " key=value" pairs.  Values containing spaces, quotes or
+// '=' are quoted.
+func (f Fields) writeText(out *bytes.Buffer) {
+	for _, field := range f {
+		out.WriteByte(' ')
+		out.WriteString(field.Key)
+		out.WriteByte('=')
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+		out.WriteString(value)
+	}
+}
+
+// Write the fields as <field name="key">value</field> elements.
+func (f Fields) writeXML(out *bytes.Buffer) {
+	for _, field := range f {
+		out.WriteString(`<field name="`)
+		xml.EscapeText(out, []byte(field.Key))
+		out.WriteString(`">`)
+		xml.EscapeText(out, []byte(fmt.Sprint(field.Value)))
+		out.WriteString(`</field>`)
+	}
+}
+
+// String returns the fields formatted as for the %F format code.
+func (f Fields) String() string {
+	out := new(bytes.Buffer)
+	f.writeText(out)
+	return strings.TrimPrefix(out.String(), " ")
+}
+
+// MarshalJSON encodes the fields as a JSON object, preserving their order.
+// Values which cannot be encoded are written as their fmt.Sprint form.
+func (f Fields) MarshalJSON() ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, 64))
+	out.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		out.Write(key)
+		out.WriteByte(':')
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(field.Value))
+		}
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+/****** FieldLogger ******/
+
+// A FieldLogger writes through a Logger, attaching its fields to every record.
+// Use Logger.With to create one.
+type FieldLogger struct {
+	logger *Logger
+	fields Fields
+}
+
+// With returns a FieldLogger whose records carry the given alternating keys
+// and values, e.g. log.With("request", id, "user", uid).Info("done").
+func (log *Logger) With(kv ...interface{}) *FieldLogger {
+	return &FieldLogger{log, kvToFields(kv)}
+}
+
+// With returns a FieldLogger carrying the fields of fl followed by kv.
+func (fl *FieldLogger) With(kv ...interface{}) *FieldLogger {
+	return &FieldLogger{fl.logger, fl.fields.concat(kvToFields(kv))}
+}
+
+// Fields returns the fields attached to every record written by fl.
+func (fl *FieldLogger) Fields() Fields {
+	return fl.fields
+}
+
+// Finest logs a message at the finest log level.
+// See Logger.Debug for an explanation of the arguments.
+func (fl *FieldLogger) Finest(arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(nil, FINEST, fl.fields, arg0, args...)
+}
+
+// Fine logs a message at the fine log level.
+// See Logger.Debug for an explanation of the arguments.
+func (fl *FieldLogger) Fine(arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(nil, FINE, fl.fields, arg0, args...)
+}
+
+// Debug logs a message at the debug log level.
+// See Logger.Debug for an explanation of the arguments.
+func (fl *FieldLogger) Debug(arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(nil, DEBUG, fl.fields, arg0, args...)
+}
+
+// Trace logs a message at the trace log level.
+// See Logger.Debug for an explanation of the arguments.
+func (fl *FieldLogger) Trace(arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(nil, TRACE, fl.fields, arg0, args...)
+}
+
+// Info logs a message at the info log level.
+// See Logger.Debug for an explanation of the arguments.
+func (fl *FieldLogger) Info(arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(nil, INFO, fl.fields, arg0, args...)
+}
+
+// Warn logs a message at the warning log level and returns the formatted error.
+// See Logger.Warn for an explanation of the arguments.
+func (fl *FieldLogger) Warn(arg0 interface{}, args ...interface{}) error {
+	return fl.logger.intLog(nil, WARNING, fl.fields, arg0, args...)
+}
+
+// Error logs a message at the error log level and returns the formatted error.
+// See Logger.Warn for an explanation of the arguments.
+func (fl *FieldLogger) Error(arg0 interface{}, args ...interface{}) error {
+	return fl.logger.intLog(nil, ERROR, fl.fields, arg0, args...)
+}
+
+// Critical logs a message at the critical log level and returns the formatted error.
+// See Logger.Warn for an explanation of the arguments.
+func (fl *FieldLogger) Critical(arg0 interface{}, args ...interface{}) error {
+	return fl.logger.intLog(nil, CRITICAL, fl.fields, arg0, args...)
+}
+
+// Finestw logs msg at the finest log level with additional alternating keys
+// and values.
+func (fl *FieldLogger) Finestw(msg string, kv ...interface{}) {
+	fl.logger.intLog(nil, FINEST, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Finew logs msg at the fine log level with additional alternating keys and
+// values.
+func (fl *FieldLogger) Finew(msg string, kv ...interface{}) {
+	fl.logger.intLog(nil, FINE, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Debugw logs msg at the debug log level with additional alternating keys and
+// values.
+func (fl *FieldLogger) Debugw(msg string, kv ...interface{}) {
+	fl.logger.intLog(nil, DEBUG, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Tracew logs msg at the trace log level with additional alternating keys and
+// values.
+func (fl *FieldLogger) Tracew(msg string, kv ...interface{}) {
+	fl.logger.intLog(nil, TRACE, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Infow logs msg at the info log level with additional alternating keys and
+// values.
+func (fl *FieldLogger) Infow(msg string, kv ...interface{}) {
+	fl.logger.intLog(nil, INFO, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Warnw logs msg at the warning log level with additional alternating keys and
+// values, and returns msg as an error.
+func (fl *FieldLogger) Warnw(msg string, kv ...interface{}) error {
+	return fl.logger.intLog(nil, WARNING, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Errorw logs msg at the error log level with additional alternating keys and
+// values, and returns msg as an error.
+func (fl *FieldLogger) Errorw(msg string, kv ...interface{}) error {
+	return fl.logger.intLog(nil, ERROR, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// Criticalw logs msg at the critical log level with additional alternating
+// keys and values, and returns msg as an error.
+func (fl *FieldLogger) Criticalw(msg string, kv ...interface{}) error {
+	return fl.logger.intLog(nil, CRITICAL, fl.fields.concat(kvToFields(kv)), msg)
+}
+
+// FinestCtx logs a message at the finest log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(ctx, FINEST, fl.fields, arg0, args...)
+}
+
+// FineCtx logs a message at the fine log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(ctx, FINE, fl.fields, arg0, args...)
+}
+
+// DebugCtx logs a message at the debug log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(ctx, DEBUG, fl.fields, arg0, args...)
+}
+
+// TraceCtx logs a message at the trace log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(ctx, TRACE, fl.fields, arg0, args...)
+}
+
+// InfoCtx logs a message at the info log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	fl.logger.intLog(ctx, INFO, fl.fields, arg0, args...)
+}
+
+// WarnCtx logs a message at the warning log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return fl.logger.intLog(ctx, WARNING, fl.fields, arg0, args...)
+}
+
+// ErrorCtx logs a message at the error log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return fl.logger.intLog(ctx, ERROR, fl.fields, arg0, args...)
+}
+
+// CriticalCtx logs a message at the critical log level with the fields found in ctx.
+// See Logger.DebugCtx for an explanation of the arguments.
+func (fl *FieldLogger) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return fl.logger.intLog(ctx, CRITICAL, fl.fields, arg0, args...)
+}
@@ -11,12 +11,16 @@ package log4go
 import (
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
 // This log writer sends output to a file
 type FileLogWriter struct {
-	rec chan *LogRecord
+	bytes     uint64 // bytes written, accessed atomically
+	rotations uint64 // rotations performed, accessed atomically
+
+	recordQueue
 	rot chan bool
 
 	// The opened file
@@ -24,10 +28,10 @@ type FileLogWriter struct {
 	file     *os.File
 
 	// The logging format
-	format string
+	pattern *Pattern
 
 	// File header/trailer
-	header, trailer string
+	header, trailer *Pattern
 
 	// Rotate at linecount
 	maxlines          int
@@ -45,13 +49,16 @@ type FileLogWriter struct {
 	rotate bool
 }
 
-// This is the FileLogWriter's output method
+// This is the FileLogWriter's output method.  If the output buffer is full
+// this blocks or drops a record, see SetOverflowPolicy.
 func (w *FileLogWriter) LogWrite(rec *LogRecord) {
-	w.rec <- rec
+	w.put(rec)
 }
 
+// Close stops the writer once the buffered records have been written, and
+// closes the file after writing its trailer.
 func (w *FileLogWriter) Close() {
-	close(w.rec)
+	w.close()
 }
 
 // NewFileLogWriter creates a new LogWriter which writes to the given file and
@@ -62,26 +69,39 @@ func (w *FileLogWriter) Close() {
 // to configure log rotation based on lines, size, and daily.
 //
 // The standard log-line format is:
-//   [%D %T] [%L] (%S) %M
+//   [%D %T] [%L] (%S) %M%F%K
 func NewFileLogWriter(fname string, rotate bool) *FileLogWriter {
+	w, err := newFileLogWriter(fname, rotate)
+	if err != nil {
+		DefaultErrorHandler(err)
+		return nil
+	}
+	return w
+}
+
+// Create a FileLogWriter, returning a failure to open the file instead of
+// reporting it.
+func newFileLogWriter(fname string, rotate bool) (*FileLogWriter, *WriterError) {
 	w := &FileLogWriter{
-		rec:      make(chan *LogRecord, LogBufferLength),
-		rot:      make(chan bool),
-		filename: fname,
-		format:   "[%D %T] [%L] (%S) %M",
-		rotate:   rotate,
+		recordQueue: newRecordQueue(LogBufferLength),
+		rot:         make(chan bool),
+		filename:    fname,
+		pattern:     MustCompilePattern(FORMAT_DEFAULT),
+		header:      MustCompilePattern(""),
+		trailer:     MustCompilePattern(""),
+		rotate:      rotate,
 	}
 
 	// open the file for the first time
 	if err := w.intRotate(); err != nil {
-		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-		return nil
+		return nil, &WriterError{Writer: w.name(), Op: "open", Err: err}
 	}
 
 	go func() {
+		defer close(w.done)
 		defer func() {
 			if w.file != nil {
-				fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+				fmt.Fprint(w.file, w.trailer.Format(&LogRecord{Created: time.Now()}))
 				w.file.Close()
 			}
 		}()
@@ -90,38 +110,70 @@ func NewFileLogWriter(fname string, rotate bool) *FileLogWriter {
 			select {
 			case <-w.rot:
 				if err := w.intRotate(); err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+					w.reportError(w.name(), "rotate", err, nil)
 					return
 				}
-			case rec, ok := <-w.rec:
-				if !ok {
+			case rec, ok := <-w.records:
+				if !ok || writeRecord(w.write, rec) != nil {
 					return
 				}
-				now := time.Now()
-				if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
-					(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) ||
-					(w.daily && now.Day() != w.daily_opendate) {
-					if err := w.intRotate(); err != nil {
-						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-						return
-					}
+			case ack := <-w.flushes:
+				ok := w.drain(w.write)
+				if err := w.file.Sync(); err != nil && ok {
+					w.reportError(w.name(), "sync", err, nil)
 				}
-
-				// Perform the write
-				n, err := fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+				close(ack)
+				if !ok {
 					return
 				}
-
-				// Update the counts
-				w.maxlines_curlines++
-				w.maxsize_cursize += n
 			}
 		}
 	}()
 
-	return w
+	return w, nil
+}
+
+// Write rec to the file, rotating it first if needed.  Must be called by the
+// writer's goroutine.
+func (w *FileLogWriter) write(rec *LogRecord) error {
+	now := time.Now()
+	if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
+		(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) ||
+		(w.daily && now.Day() != w.daily_opendate) {
+		if err := w.intRotate(); err != nil {
+			w.reportError(w.name(), "rotate", err, rec)
+			return err
+		}
+	}
+
+	// Perform the write
+	buf := getBuffer()
+	defer putBuffer(buf)
+	w.pattern.write(buf, rec)
+	n, err := w.file.Write(buf.Bytes())
+	if err != nil {
+		w.reportError(w.name(), "write", err, rec)
+		return err
+	}
+
+	// Update the counts
+	w.maxlines_curlines++
+	w.maxsize_cursize += n
+	atomic.AddUint64(&w.bytes, uint64(n))
+	return nil
+}
+
+// WriterStats returns the counters of the writer.
+func (w *FileLogWriter) WriterStats() WriterStats {
+	stats := w.recordQueue.WriterStats()
+	stats.Bytes = atomic.LoadUint64(&w.bytes)
+	stats.Rotations = atomic.LoadUint64(&w.rotations)
+	return stats
+}
+
+// The name of the writer in its errors
+func (w *FileLogWriter) name() string {
+	return fmt.Sprintf("FileLogWriter(%q)", w.filename)
 }
 
 // Request that the logs rotate
@@ -133,8 +185,9 @@ func (w *FileLogWriter) Rotate() {
 func (w *FileLogWriter) intRotate() error {
 	// Close any log file that may be open
 	if w.file != nil {
-		fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+		fmt.Fprint(w.file, w.trailer.Format(&LogRecord{Created: time.Now()}))
 		w.file.Close()
+		atomic.AddUint64(&w.rotations, 1)
 	}
 
 	// If we are keeping log files, move it to the next available number
@@ -169,7 +222,7 @@ func (w *FileLogWriter) intRotate() error {
 	w.file = fd
 
 	now := time.Now()
-	fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: now}))
+	fmt.Fprint(w.file, w.header.Format(&LogRecord{Created: now}))
 
 	// Set the daily open date to the current date
 	w.daily_opendate = now.Day()
@@ -181,20 +234,41 @@ func (w *FileLogWriter) intRotate() error {
 	return nil
 }
 
-// Set the logging format (chainable).  Must be called before the first log
-// message is written.
+// Set the logging format (chainable).  An invalid format is reported to the
+// writer's ErrorHandler, and its invalid codes are ignored.  Must be called
+// before the first log message is written.
 func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
-	w.format = format
+	return w.SetPattern(w.compile(format))
+}
+
+// Set the compiled logging format (chainable).  Must be called before the
+// first log message is written.
+func (w *FileLogWriter) SetPattern(p *Pattern) *FileLogWriter {
+	w.pattern = p
 	return w
 }
 
+// Compile format, reporting it if it is invalid.
+func (w *FileLogWriter) compile(format string) *Pattern {
+	p, err := compilePattern(format)
+	if err != nil {
+		w.reportError(w.name(), "format", err, nil)
+	}
+	return p
+}
+
+// RecordParts reports the costly record parts used by the format.
+func (w *FileLogWriter) RecordParts() RecordPart {
+	return w.pattern.parts
+}
+
 // Set the logfile header and footer (chainable).  Must be called before the first log
 // message is written.  These are formatted similar to the FormatLogRecord (e.g.
 // you can use %D and %T in your header/footer for date and time).
 func (w *FileLogWriter) SetHeadFoot(head, foot string) *FileLogWriter {
-	w.header, w.trailer = head, foot
+	w.header, w.trailer = w.compile(head), w.compile(foot)
 	if w.maxlines_curlines == 0 {
-		fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: time.Now()}))
+		fmt.Fprint(w.file, w.header.Format(&LogRecord{Created: time.Now()}))
 	}
 	return w
 }
@@ -236,10 +310,19 @@ func (w *FileLogWriter) SetRotate(rotate bool) *FileLogWriter {
 // NewXMLLogWriter is a utility method for creating a FileLogWriter set up to
 // output XML record log messages instead of line-based ones.
 func NewXMLLogWriter(fname string, rotate bool) *FileLogWriter {
-	return NewFileLogWriter(fname, rotate).SetFormat(
+	w := NewFileLogWriter(fname, rotate)
+	if w == nil {
+		return nil
+	}
+	return w.setXML()
+}
+
+// Set the format, header and trailer of an XML log.
+func (w *FileLogWriter) setXML() *FileLogWriter {
+	return w.SetFormat(
 		`	<record level="%L">
 		<timestamp>%D %T</timestamp>
 		<source>%S</source>
-		<message>%M</message>
+		<message>%M</message>%X
 	</record>`).SetHeadFoot("<log created=\"%D %T\">", "</log>")
 }
@@ -19,5 +19,5 @@ import (
 
 func traceCheck() {
 	pc, _, lineno, ok := runtime.Caller(1)
-	fmt.Fprintf(os.Stderr, ">>> [%s][%s][%s]\n", runtime.FuncForPC(pc).Name(), lineno, ok)
+	fmt.Fprintf(os.Stderr, ">>> [%s][%d][%t]\n", runtime.FuncForPC(pc).Name(), lineno, ok)
 }
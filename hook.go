@@ -0,0 +1,102 @@
+/* hook.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"sort"
+)
+
+// A Hook is called with every record logged through a Logger, once the record
+// is built and before the filters are consulted.  It may modify the record,
+// e.g. add fields (see LogRecord.AddFields) or rewrite the message, and
+// returns false to discard it.  The Source and Stack of the record are only
+// set when a filter writes them.  The record must not be kept once the hook
+// returns, it is reused for other messages.
+type Hook func(rec *LogRecord) bool
+
+// A hook of a Logger
+type namedHook struct {
+	name  string
+	order int
+	hook  Hook
+}
+
+// AddHook adds h to the hooks of the Logger under name, replacing a hook
+// already registered under that name.  Hooks run by increasing order, and in
+// the order they were added for equal orders.  The hooks of the ancestors of
+// a named logger run before its own, whatever their order.  Returns the logger
+// for chaining.
+func (log *Logger) AddHook(name string, order int, h Hook) *Logger {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	// The list is replaced as a whole so that it can be run without the lock
+	hooks := make([]namedHook, 0, len(log.hooks)+1)
+	for _, nh := range log.hooks {
+		if nh.name != name {
+			hooks = append(hooks, nh)
+		}
+	}
+	hooks = append(hooks, namedHook{name: name, order: order, hook: h})
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].order < hooks[j].order })
+	log.hooks = hooks
+	return log
+}
+
+// RemoveHook removes the named hook from the Logger.  Returns false if there
+// was no such hook.
+func (log *Logger) RemoveHook(name string) bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	for i, nh := range log.hooks {
+		if nh.name == name {
+			hooks := make([]namedHook, 0, len(log.hooks)-1)
+			log.hooks = append(append(hooks, log.hooks[:i]...), log.hooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Hooks returns the names of the hooks of the Logger in the order they run.
+func (log *Logger) Hooks() []string {
+	log.mu.RLock()
+	defer log.mu.RUnlock()
+
+	names := make([]string, len(log.hooks))
+	for i, nh := range log.hooks {
+		names[i] = nh.name
+	}
+	return names
+}
+
+// Run the hooks of the ancestors of the Logger and its own on rec.  Returns
+// false if a hook discarded it.  The hooks run without the lock held, so they
+// may log themselves.
+func (log *Logger) runHooks(rec *LogRecord) bool {
+	if log.parent != nil && !log.parent.runHooks(rec) {
+		return false
+	}
+
+	log.mu.RLock()
+	hooks := log.hooks
+	log.mu.RUnlock()
+
+	for _, nh := range hooks {
+		if !nh.hook(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddFields appends alternating keys and values to the fields of the record,
+// as Logger.With does.  The fields shared with other records are not
+// modified.
+func (rec *LogRecord) AddFields(kv ...interface{}) {
+	rec.Fields = rec.Fields.concat(kvToFields(kv))
+}
@@ -0,0 +1,220 @@
+/* level.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The name and short code of a level
+type levelInfo struct {
+	name, code string
+}
+
+// The registered levels.  The maps are never modified once published, they
+// are replaced as a whole by RegisterLevel.
+var levels struct {
+	sync.RWMutex
+	info   map[Level]levelInfo
+	byName map[string]Level // upper-cased names and codes
+	sorted []Level          // in increasing order
+}
+
+func init() {
+	levels.info = make(map[Level]levelInfo)
+	levels.byName = make(map[string]Level)
+	for _, l := range []struct {
+		lvl        Level
+		name, code string
+	}{
+		{FINEST, "FINEST", "FNST"},
+		{FINE, "FINE", "FINE"},
+		{DEBUG, "DEBUG", "DEBG"},
+		{TRACE, "TRACE", "TRAC"},
+		{INFO, "INFO", "INFO"},
+		{WARNING, "WARNING", "WARN"},
+		{ERROR, "ERROR", "EROR"},
+		{CRITICAL, "CRITICAL", "CRIT"},
+	} {
+		if err := RegisterLevel(l.lvl, l.name, l.code); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterLevel adds a custom level, e.g.
+//
+//   const NOTICE log4go.Level = log4go.INFO + 5
+//   log4go.RegisterLevel(NOTICE, "NOTICE", "NOTC")
+//
+// Its name and code are recognized (case-insensitively) by ParseLevel and the
+// configuration, and the code is written by %L.  The name, the code and the
+// level itself must not be registered already.  Records at a custom level are
+// written with Logger.Log, Logf or Logc.  Levels 1 to 7 are parsed by name
+// only, their numbers being read as the old built-in levels.
+func RegisterLevel(lvl Level, name, code string) error {
+	if name == "" || code == "" {
+		return fmt.Errorf("log4go: level %d: empty name or code", lvl)
+	}
+
+	levels.Lock()
+	defer levels.Unlock()
+
+	if l, ok := levels.info[lvl]; ok {
+		return fmt.Errorf("log4go: level %d already registered as %s", lvl, l.name)
+	}
+	for _, s := range []string{name, code} {
+		if l, ok := levels.byName[strings.ToUpper(s)]; ok {
+			return fmt.Errorf("log4go: %q already used by level %s", s, levels.info[l].name)
+		}
+	}
+
+	info := make(map[Level]levelInfo, len(levels.info)+1)
+	for l, i := range levels.info {
+		info[l] = i
+	}
+	info[lvl] = levelInfo{name, code}
+
+	byName := make(map[string]Level, len(levels.byName)+2)
+	for s, l := range levels.byName {
+		byName[s] = l
+	}
+	byName[strings.ToUpper(name)] = lvl
+	byName[strings.ToUpper(code)] = lvl
+
+	sorted := make([]Level, 0, len(levels.sorted)+1)
+	sorted = append(sorted, levels.sorted...)
+	sorted = append(sorted, lvl)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	levels.info, levels.byName, levels.sorted = info, byName, sorted
+	return nil
+}
+
+// Levels returns the registered levels in increasing order.
+func Levels() []Level {
+	sorted := registeredLevels()
+	return append(make([]Level, 0, len(sorted)), sorted...)
+}
+
+// Return the registered levels in increasing order, not to be modified.
+func registeredLevels() []Level {
+	levels.RLock()
+	defer levels.RUnlock()
+	return levels.sorted
+}
+
+// ParseLevel returns the level having the given name or code, ignoring case.
+// A decimal number is accepted for unregistered levels.
+func ParseLevel(s string) (Level, error) {
+	if lvl, ok := levelNamed(s); ok {
+		return lvl, nil
+	}
+
+	if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		return Level(n), nil
+	}
+	return DEBUG, fmt.Errorf("log4go: unknown level %q", s)
+}
+
+// Return the level sent as the JSON number n.  The numbers 1 to 7 are read as
+// the levels of the versions before the levels were spaced by 10 (7 is
+// CRITICAL), whose socket writers sent levels as numbers.  Levels are now
+// marshalled as strings, which are read unchanged.
+func levelNumbered(n int) Level {
+	if n > 0 && n <= 7 {
+		return Level(10 * n)
+	}
+	return Level(n)
+}
+
+// Return the registered level having the given name or code, ignoring case.
+func levelNamed(s string) (Level, bool) {
+	levels.RLock()
+	lvl, ok := levels.byName[strings.ToUpper(strings.TrimSpace(s))]
+	levels.RUnlock()
+	return lvl, ok
+}
+
+// Return the name and code of a registered level.
+func lookupLevel(l Level) (levelInfo, bool) {
+	levels.RLock()
+	info, ok := levels.info[l]
+	levels.RUnlock()
+	return info, ok
+}
+
+// String returns the short code of the level (as written by %L), or its number
+// if it is not registered.
+func (l Level) String() string {
+	if info, ok := lookupLevel(l); ok {
+		return info.code
+	}
+	return strconv.Itoa(int(l))
+}
+
+// Name returns the name of the level (e.g. WARNING), or its number if it is
+// not registered.
+func (l Level) Name() string {
+	if info, ok := lookupLevel(l); ok {
+		return info.name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// MarshalText implements encoding.TextMarshaler; levels are marshalled by
+// name.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.Name()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see ParseLevel.
+func (l *Level) UnmarshalText(text []byte) error {
+	lvl, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = lvl
+	return nil
+}
+
+// Set implements flag.Value, so that a level can be given on the command line:
+//
+//   lvl := log4go.INFO
+//   flag.Var(&lvl, "level", "logging level")
+func (l *Level) Set(s string) error {
+	return l.UnmarshalText([]byte(s))
+}
+
+// UnmarshalJSON accepts a name, a code or a number, as ParseLevel, or a JSON
+// number, see levelNumbered.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*l = levelNumbered(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return l.UnmarshalText([]byte(s))
+}
+
+// UnmarshalYAML accepts a name, a code or a number (gopkg.in/yaml.v2).
+func (l *Level) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return l.UnmarshalText([]byte(s))
+}
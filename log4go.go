@@ -44,60 +44,62 @@
 //   particular, Logger is now a map and ConsoleLogWriter is now a channel
 //   behind-the-scenes, and the LogWrite method no longer has return values.
 //
+// Changes from 3.0:
+// - Logger is a struct safe for concurrent reconfiguration rather than a map:
+//   NewLogger and NewDefaultLogger return a *Logger, make(Logger) no longer
+//   compiles and the filters are read with Filters rather than by indexing.
+// - The levels are spaced by 10 (FINEST = 0 ... CRITICAL = 70), and the socket
+//   JSON sends the Level by name.
+// - NewSocketLogWriter and NewFormatLogWriter return pointers.
+//
 // Future work: (please let me know if you think I should work on any of these particularly)
 // - Log file rotation
 // - Logging configuration files ala log4j
-// - Have the ability to remove filters?
 // - Have GetInfoChannel, GetDebugChannel, etc return a chan string that allows
 //   for another method of logging
 // - Add an XML filter type
 package log4go
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Version information
 const (
-	L4G_VERSION = "log4go-v3.0.1"
-	L4G_MAJOR   = 3
+	L4G_VERSION = "log4go-v4.0.0"
+	L4G_MAJOR   = 4
 	L4G_MINOR   = 0
-	L4G_BUILD   = 1
+	L4G_BUILD   = 0
 )
 
 /****** Constants ******/
 
-// These are the integer logging levels used by the logger
-type level int
+// These are the integer logging levels used by the logger.  They are spaced so
+// that custom levels can be registered between them, see RegisterLevel.
+//
+// The levels used to be numbered 0 to 7 (FINEST to CRITICAL): code comparing
+// or storing levels as numbers must use the constants.  The JSON decoding still
+// reads the numbers 1 to 7 as the old levels, as sent by their socket writers.
+type Level int
 
 const (
-	FINEST level = iota
-	FINE
-	DEBUG
-	TRACE
-	INFO
-	WARNING
-	ERROR
-	CRITICAL
-)
-
-// Logging level strings
-var (
-	levelStrings = [...]string{"FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT"}
+	FINEST   Level = 0
+	FINE     Level = 10
+	DEBUG    Level = 20
+	TRACE    Level = 30
+	INFO     Level = 40
+	WARNING  Level = 50
+	ERROR    Level = 60
+	CRITICAL Level = 70
 )
 
-func (l level) String() string {
-	if l < 0 || int(l) > len(levelStrings) {
-		return "UNKNOWN"
-	}
-	return levelStrings[int(l)]
-}
-
 /****** Variables ******/
 var (
 	// LogBufferLength specifies how many log messages a particular log4go
@@ -105,24 +107,40 @@ var (
 	LogBufferLength = 32
 	// YamlConfigRoot specifies how yaml node wil be used as logger config root
 	YamlConfigRoot = "logging"
-	CallerDepth    = 2
+	// YamlCategoriesRoot specifies the yaml node holding the named loggers
+	// (categories) configuration; it is optional
+	YamlCategoriesRoot = "logging_categories"
+	CallerDepth        = 2
 )
 
 /****** LogRecord ******/
 
 // A LogRecord contains all of the pertinent information for each message
 type LogRecord struct {
-	Level   level     // The log level
+	Level   Level     // The log level
 	Created time.Time // The time at which the log message was created (nanoseconds)
 	Source  string    // The message source
 	Message string    // The log message
+	Fields  Fields    `json:",omitempty"` // Structured key/value data
+	Logger  string    `json:",omitempty"` // The name of the logger ("" for a root logger)
+	Stack   string    `json:",omitempty"` // The stack trace, see Filter.StackLevel
+
+	Caller    *Caller `json:",omitempty"` // The code which logged the message, set with Source when known
+	Goroutine uint64  `json:",omitempty"` // The ID of the logging goroutine, see PART_GOROUTINE
+	Seq       uint64  `json:",omitempty"` // The number of the record among those built by the Loggers
+
+	refs   int32 // references held, see Release; accessed atomically
+	pooled bool  // taken from the record pool
 }
 
 /****** LogWriter ******/
 
 // This is an interface for anything that should be able to write logs
 type LogWriter interface {
-	// This will be called to log a LogRecord message.
+	// This will be called to log a LogRecord message.  The LogWriter is handed
+	// a reference to rec and calls rec.Release once it no longer uses it, so
+	// the record can be reused for another message.  A LogWriter which does not
+	// release its records still works, they are then garbage collected.
 	LogWrite(rec *LogRecord)
 
 	// This should clean up anything lingering about the LogWriter, as it is called before
@@ -130,214 +148,606 @@ type LogWriter interface {
 	Close()
 }
 
+// A LogWriter may implement Flusher to let Logger.Flush wait for the records
+// it has been handed to be written out.
+type Flusher interface {
+	// Flush returns once the records handed to the LogWriter before the call
+	// have been written (and synced, for files), or the LogWriter has failed.
+	Flush()
+}
+
+// RecordPart identifies the parts of a LogRecord which are costly to compute.
+type RecordPart int
+
+const (
+	PART_SOURCE    RecordPart = 1 << iota // LogRecord.Source and Caller, from runtime.Caller
+	PART_STACK                            // LogRecord.Stack, see Filter.StackLevel
+	PART_GOROUTINE                        // LogRecord.Goroutine
+
+	PART_ALL = PART_SOURCE | PART_STACK | PART_GOROUTINE
+
+	// The parts handed to LogWriters which do not report theirs.  The
+	// goroutine ID is only looked up for writers asking for it.
+	PART_DEFAULT = PART_SOURCE | PART_STACK
+)
+
+// A LogWriter may implement PartialLogWriter to report which of the costly
+// record parts it uses, so the Logger does not compute the others for records
+// which are written only by such writers.  Other LogWriters are handed the
+// PART_DEFAULT parts.
+type PartialLogWriter interface {
+	LogWriter
+
+	// RecordParts returns the parts written by the LogWriter.  It is called
+	// for every record, so it should not do more than return a stored value.
+	RecordParts() RecordPart
+}
+
 /****** Logger ******/
 
 // A Filter represents the log level below which no log records are written to
-// the associated LogWriter.
+// the associated LogWriter.  If Match is set, only the records it matches are
+// written.  Records at or above StackLevel which are written to it carry the
+// stack trace of the logging goroutine.
 type Filter struct {
-	Level level
+	Level      Level
+	StackLevel Level
+	Match      Predicate
 	LogWriter
+
+	stats   *filterStats
+	writing *sync.WaitGroup // records being handed to the LogWriter
 }
 
-// A Logger represents a collection of Filters through which log messages are
-// written.
-type Logger map[string]*Filter
+// Return the costly parts of records at lvl which the filter uses.  The
+// source is always computed for a filter with a Predicate, which may need it.
+func (filt *Filter) parts(lvl Level) RecordPart {
+	parts := PART_DEFAULT
+	if pw, ok := filt.LogWriter.(PartialLogWriter); ok {
+		parts = pw.RecordParts()
+	}
+	if filt.Match != nil {
+		parts |= PART_SOURCE
+	}
+	if lvl < filt.StackLevel {
+		parts &^= PART_STACK
+	}
+	return parts
+}
 
-// Create a new logger.
+// Close the filter's LogWriter once the records being dispatched to it have
+// been handed over.
+func (filt *Filter) closeWriter() {
+	filt.writing.Wait()
+	filt.Close()
+}
+
+// DefaultStackLevel is the StackLevel of filters created by AddFilter and
+// ReplaceFilter, and of configured filters without a stacklevel property.  By
+// default only the records of Crash and Crashf carry a stack trace.
+var DefaultStackLevel = STACK_NONE
+
+// A Logger represents a collection of Filters through which log messages are
+// written.  A Logger is safe for concurrent use: filters may be added, removed
+// or replaced while other goroutines are logging through it.  The zero value
+// is a Logger without filters.
 //
-// DEPRECATED: Use make(Logger) instead.
-func NewLogger() Logger {
-	os.Stderr.WriteString("warning: use of deprecated NewLogger\n")
-	return make(Logger)
+// Logger used to be a map of Filters; it is now a struct used through a
+// pointer, so code which made one with make(Logger) or indexed its filters
+// must use NewLogger and Filters instead.
+type Logger struct {
+	// mu guards the filter set, which records are dispatched to once it is
+	// released; a removed LogWriter is closed only after the records being
+	// dispatched to it have been handed over.
+	mu      sync.RWMutex
+	filters map[string]*Filter
+
+	// Position in a hierarchy of named loggers, see GetLogger
+	name        string
+	parent      *Logger            // nil for a root logger
+	loggers     map[string]*Logger // named descendants of a root logger
+	level       Level              // category level, if hasLevel
+	hasLevel    bool
+	nonAdditive bool // do not pass records on to the parent's filters
+
+	onError ErrorHandler // see SetErrorHandler
+	hooks   []namedHook  // see AddHook, replaced as a whole
+
+	termination *TerminationPolicy // see SetTerminationPolicy
+}
+
+// Create a new logger without any filters.  It returns a *Logger, where
+// earlier versions returned a Logger map.
+func NewLogger() *Logger {
+	return &Logger{filters: make(map[string]*Filter)}
 }
 
 // Create a new logger with a "stdout" filter configured to send log messages at
 // or above lvl to standard output.
 //
 // DEPRECATED: use NewDefaultLogger instead.
-func NewConsoleLogger(lvl level) Logger {
+func NewConsoleLogger(lvl Level) *Logger {
 	os.Stderr.WriteString("warning: use of deprecated NewConsoleLogger\n")
-	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter()},
-	}
+	return NewDefaultLogger(lvl)
 }
 
 // Create a new logger with a "stdout" filter configured to send log messages at
 // or above lvl to standard output.
-func NewDefaultLogger(lvl level) Logger {
-	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter()},
-	}
+func NewDefaultLogger(lvl Level) *Logger {
+	return NewLogger().AddFilter("stdout", lvl, NewConsoleLogWriter())
 }
 
 // Closes all log writers in preparation for exiting the program or a
 // reconfiguration of logging.  Calling this is not really imperative, unless
-// you want to guarantee that all log messages are written.  Close removes
-// all filters (and thus all LogWriters) from the logger.
-func (log Logger) Close() {
+// you want to guarantee that all log messages are written: the LogWriters of
+// this package return from Close once their pending records are written.
+// Close removes all filters (and thus all LogWriters) from the logger.
+// Closing a root logger also closes the filters of its named loggers and
+// resets their category levels and additivity.
+func (log *Logger) Close() {
+	log.mu.Lock()
+	filters := log.filters
+	log.filters = nil
+	loggers := make([]*Logger, 0, len(log.loggers))
+	for _, named := range log.loggers {
+		loggers = append(loggers, named)
+	}
+	log.mu.Unlock()
+
 	// Close all open loggers
-	for name, filt := range log {
-		filt.Close()
-		delete(log, name)
+	for _, filt := range filters {
+		filt.closeWriter()
+	}
+	for _, named := range loggers {
+		named.Close()
+		named.resetCategory()
+	}
+}
+
+// SetErrorHandler sets the handler of the failures of the Logger's writers
+// which have no ErrorHandler of their own, and of its configuration loading.
+// A named logger without one uses its parent's, and a root logger without
+// one uses DefaultErrorHandler.  A nil h restores this default.
+func (log *Logger) SetErrorHandler(h ErrorHandler) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.onError = h
+}
+
+// Pass err to the ErrorHandler of the Logger.
+func (log *Logger) handleError(err *WriterError) {
+	for l := log; l != nil; l = l.parent {
+		l.mu.RLock()
+		h := l.onError
+		l.mu.RUnlock()
+		if h != nil {
+			h(err)
+			return
+		}
+	}
+	DefaultErrorHandler(err)
+}
+
+// Flush waits for the LogWriters implementing Flusher to write the records
+// they have been handed, including the writers of the named loggers of a root
+// logger.  It gives up after timeout (if positive) and returns an error if
+// some writers have not finished by then.
+func (log *Logger) Flush(timeout time.Duration) error {
+	loggers := []*Logger{log}
+	if log.parent == nil {
+		loggers = append(loggers, log.Loggers()...)
+	}
+
+	var flushers []Flusher
+	for _, l := range loggers {
+		l.mu.RLock()
+		for _, filt := range l.filters {
+			if f, ok := filt.LogWriter.(Flusher); ok {
+				flushers = append(flushers, f)
+			}
+		}
+		l.mu.RUnlock()
+	}
+
+	done := make(chan bool, len(flushers))
+	for _, f := range flushers {
+		go func(f Flusher) {
+			f.Flush()
+			done <- true
+		}(f)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
 	}
+	for pending := len(flushers); pending > 0; pending-- {
+		select {
+		case <-done:
+		case <-expired:
+			return fmt.Errorf("log4go: %d of %d writers not flushed after %s", pending, len(flushers), timeout)
+		}
+	}
+	return nil
 }
 
 // Add a new LogWriter to the Logger which will only log messages at lvl or
-// higher.  This function should not be called from multiple goroutines.
-// Returns the logger for chaining.
-func (log Logger) AddFilter(name string, lvl level, writer LogWriter) Logger {
-	log[name] = &Filter{lvl, writer}
+// higher.  A filter already registered under name is replaced without being
+// closed; use ReplaceFilter to close it.  Returns the logger for chaining.
+func (log *Logger) AddFilter(name string, lvl Level, writer LogWriter) *Logger {
+	log.setFilter(name, &Filter{Level: lvl, StackLevel: DefaultStackLevel, LogWriter: writer})
 	return log
 }
 
-/******* Logging *******/
-// Send a formatted log or a closure fruc message internally
-func (log Logger) intLog(lvl level, arg0 interface{}, args ...interface{}) error {
-	skip := true
+// RemoveFilter removes the named filter from the Logger and closes its
+// LogWriter once records being dispatched to it have been handed over.
+// Returns false if there is no such filter.
+func (log *Logger) RemoveFilter(name string) bool {
+	old := log.setFilter(name, nil)
+	if old == nil {
+		return false
+	}
+	old.closeWriter()
+	return true
+}
 
-	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
+// ReplaceFilter installs writer under name, like AddFilter, and closes the
+// LogWriter previously registered under that name (if any) once records being
+// dispatched to it have been handed over.  Returns the logger for chaining.
+func (log *Logger) ReplaceFilter(name string, lvl Level, writer LogWriter) *Logger {
+	if old := log.setFilter(name, &Filter{Level: lvl, StackLevel: DefaultStackLevel, LogWriter: writer}); old != nil && old.LogWriter != writer {
+		old.closeWriter()
+	}
+	return log
+}
+
+// SetLevel changes the level of the named filter; records already handed to
+// its LogWriter are not affected.  Returns false if there is no such filter.
+func (log *Logger) SetLevel(name string, lvl Level) bool {
+	_, ok := log.swapLevel(name, nil, lvl)
+	return ok
+}
+
+// SetStackLevel changes the level from which records written to the named
+// filter carry a stack trace; use STACK_NONE to disable stack traces.  Returns
+// false if there is no such filter.
+func (log *Logger) SetStackLevel(name string, lvl Level) bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	filt, ok := log.filters[name]
+	if ok {
+		filt.StackLevel = lvl
+	}
+	return ok
+}
+
+// SetMatch restricts the records written to the named filter to those matched
+// by p, in addition to its level; a nil p removes the restriction.  Returns
+// false if there is no such filter.
+func (log *Logger) SetMatch(name string, p Predicate) bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	filt, ok := log.filters[name]
+	if ok {
+		filt.Match = p
+	}
+	return ok
+}
+
+// Set the level of the named filter to lvl, provided it is currently *expect
+// (or expect is nil), and return its previous level.
+func (log *Logger) swapLevel(name string, expect *Level, lvl Level) (Level, bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	filt, ok := log.filters[name]
+	if !ok || (expect != nil && filt.Level != *expect) {
+		return 0, false
+	}
+	old := filt.Level
+	filt.Level = lvl
+	return old, true
+}
+
+// Filters returns a snapshot of the Logger's filters by name.  Changing the
+// returned Filters does not affect the Logger.
+func (log *Logger) Filters() map[string]Filter {
+	log.mu.RLock()
+	defer log.mu.RUnlock()
+
+	filters := make(map[string]Filter, len(log.filters))
+	for name, filt := range log.filters {
+		filters[name] = *filt
+	}
+	return filters
+}
+
+// Store filt under name (or delete name if filt is nil) and return the filter
+// it replaced.  Once this returns no record is dispatched to the old one
+// which was not already, see closeWriter.
+func (log *Logger) setFilter(name string, filt *Filter) *Filter {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	old := log.filters[name]
+	if filt == nil {
+		delete(log.filters, name)
+		return old
+	}
+	if log.filters == nil {
+		log.filters = make(map[string]*Filter)
+	}
+	if ew, ok := filt.LogWriter.(errorHandlerSetter); ok {
+		ew.setLoggerErrorHandler(log.handleError)
+	}
+	if filt.stats == nil {
+		filt.stats = new(filterStats)
+	}
+	if filt.writing == nil {
+		filt.writing = new(sync.WaitGroup)
+	}
+	log.filters[name] = filt
+	return old
+}
+
+// Report whether any filter will accept records at lvl, and which of the
+// costly record parts those filters use.  For a named logger this applies its
+// effective category level and consults the filters of its ancestors as long
+// as the loggers passed through are additive.
+func (log *Logger) wants(lvl Level) (write bool, parts RecordPart) {
+	levelSet, additive := false, true
+	for l := log; l != nil; l = l.parent {
+		l.mu.RLock()
+		if !levelSet && l.hasLevel {
+			levelSet = true
+			if lvl < l.level {
+				l.mu.RUnlock()
+				return false, 0
+			}
+		}
+		if additive && parts != PART_ALL {
+			for _, filt := range l.filters {
+				if lvl >= filt.Level {
+					write = true
+					parts |= filt.parts(lvl)
+				}
+			}
+			additive = !l.nonAdditive
+		}
+		l.mu.RUnlock()
+
+		if levelSet && (parts == PART_ALL || !additive) {
 			break
 		}
 	}
-	if skip {
-		return nil
+	return write, parts
+}
+
+// Run the hooks on rec and dispatch it, then release the caller's reference
+// to it.
+func (log *Logger) emit(rec *LogRecord) {
+	if log.runHooks(rec) {
+		log.dispatch(rec)
+	}
+	rec.Release()
+}
+
+// Hand rec to every filter accepting its level and matching it, followed by
+// the filters of the ancestors of an additive named logger.  Each LogWriter is
+// handed a reference of its own.  The filters are chosen under the loggers'
+// locks but written to without them, so a LogWriter blocking on a full buffer
+// does not hold up changes to the filters.
+func (log *Logger) dispatch(rec *LogRecord) {
+	var buf [8]*Filter
+	targets := buf[:0]
+	for l := log; l != nil; l = l.parent {
+		l.mu.RLock()
+		for _, filt := range l.filters {
+			if rec.Level < filt.Level || (filt.Match != nil && !filt.Match(rec)) {
+				continue
+			}
+			filt.writing.Add(1)
+			targets = append(targets, filt)
+		}
+		additive := !l.nonAdditive
+		l.mu.RUnlock()
+
+		if !additive {
+			break
+		}
 	}
 
-	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(CallerDepth)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
+	for _, filt := range targets {
+		filt.stats.accept(rec.Level)
+		rec.Retain()
+		filt.LogWrite(rec)
+		filt.writing.Done()
+	}
+}
+
+/******* Logging *******/
+// Send a formatted log or a closure fruc message internally, attaching fields
+// and anything the registered ContextExtractors find in ctx (which may be nil)
+// to the record.  The message is returned as an error at the levels whose
+// methods return it, WARNING and above.
+func (log *Logger) intLog(ctx context.Context, lvl Level, fields Fields, arg0 interface{}, args ...interface{}) error {
+	return log.output(CallerDepth+1, ctx, lvl, fields, false, arg0, args...)
+}
+
+// Build a record from arg0 and args (see Debug) and dispatch it.  calldepth is
+// the number of frames between output and the function the record is
+// attributed to, as for runtime.Caller.  If forceStack is set the record
+// carries a stack trace regardless of the filters' StackLevel.
+func (log *Logger) output(calldepth int, ctx context.Context, lvl Level, fields Fields, forceStack bool, arg0 interface{}, args ...interface{}) error {
+	// Determine if any logging will be done
+	write, parts := log.wants(lvl)
+	if !write {
+		return nil
 	}
 
-	var rec LogRecord
+	if ctx != nil {
+		fields = fields.concat(contextFields(ctx))
+	}
+	if forceStack {
+		parts |= PART_STACK
+	}
 
-	switch arg0.(type) {
+	var msg string
+	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string or a formated message
-		msg := arg0.(string)
+		msg = first
 		if len(args) > 0 {
-			format := arg0.(string)
-			msg = fmt.Sprintf(format, args...)
-		}
-		// Make the log record
-		rec = LogRecord{
-			Level:   lvl,
-			Created: time.Now(),
-			Source:  src,
-			Message: msg,
+			msg = fmt.Sprintf(first, args...)
 		}
 	case func() string:
 		// Log the closure (no other arguments used)
-		rec = LogRecord{
-			Level:   lvl,
-			Created: time.Now(),
-			Source:  src,
-			Message: arg0.(func() string)(),
-		}
+		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		format := fmt.Sprint(arg0) + strings.Repeat(" %v", len(args))
-		return log.intLog(lvl, format, args...)
+		msg = fmt.Sprintf(fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
 	}
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(&rec)
+	rec := log.newRecord(lvl, parts, msg, fields, callSite{skip: calldepth})
+
+	// Dispatch the logs, keeping the message as the hooks left it
+	if log.runHooks(rec) {
+		log.dispatch(rec)
 	}
+	msg = rec.Message
+	rec.Release()
 
-	return errors.New(rec.Message)
+	if lvl < WARNING {
+		return nil
+	}
+	return errors.New(msg)
 }
 
-// Send a log message with manual level, source, and message.
-func (log Logger) Log(lvl level, source, message string) {
-	skip := true
+// The call site a record is attributed to.
+type callSite struct {
+	skip int                                   // the frames above the function logging, as for runtime.Caller
+	pc   uintptr                               // the call site if it is known, e.g. from an slog.Record
+	trim func([]runtime.Frame) []runtime.Frame // drops the frames of an adapter, e.g. of the log package
+}
 
-	// Determine if any logging will be done
-	fmt.Fprintf(os.Stderr, "Log")
-	for _, filt := range log {
-		fmt.Fprintf(os.Stderr, "%s", filt)
-		if lvl >= filt.Level {
-			skip = false
-			break
+// Make a record at lvl with the costly parts the filters want, attributed to
+// site, for the function logging to emit.
+func (log *Logger) newRecord(lvl Level, parts RecordPart, msg string, fields Fields, site callSite) *LogRecord {
+	// The frames are only walked for the stack or to find the call site
+	var frames []runtime.Frame
+	if parts&PART_STACK != 0 || (parts&PART_SOURCE != 0 && site.pc == 0 && site.trim != nil) {
+		frames = callerFrames(site.skip + 1)
+		if site.trim != nil {
+			frames = site.trim(frames)
 		}
 	}
-	if skip {
-		return
+
+	var caller *Caller
+	src := ""
+	if parts&PART_SOURCE != 0 {
+		switch {
+		case site.pc != 0:
+			caller = callerOf(site.pc)
+		case site.trim != nil:
+			caller = newCaller(frames[0])
+		default:
+			caller = callerAt(site.skip + 2)
+		}
+		if caller != nil {
+			src = caller.source
+		}
 	}
 
-	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  source,
-		Message: message,
+	var trace string
+	if parts&PART_STACK != 0 {
+		trace = formatStack(frames)
 	}
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
+	var goid uint64
+	if parts&PART_GOROUTINE != 0 {
+		goid = goroutineID()
 	}
+
+	return getLogRecord(LogRecord{
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    src,
+		Message:   msg,
+		Fields:    fields,
+		Logger:    log.name,
+		Stack:     trace,
+		Caller:    caller,
+		Goroutine: goid,
+	})
+}
+
+// Send a log message with manual level, source, and message.
+func (log *Logger) Log(lvl Level, source, message string) {
+	// Determine if any logging will be done
+	write, parts := log.wants(lvl)
+	if !write {
+		return
+	}
+
+	// Make the log record and dispatch it
+	rec := log.newRecord(lvl, parts&^PART_SOURCE, message, nil, callSite{skip: 1})
+	rec.Source = source
+	log.emit(rec)
 }
 
 // Logf logs a formatted log message at the given log level, using the caller as its source.
-func (log Logger) Logf(lvl level, format string, args ...interface{}) {
-	log.intLog(lvl, format, args...)
+func (log *Logger) Logf(lvl Level, format string, args ...interface{}) {
+	log.intLog(nil, lvl, nil, format, args...)
 }
 
 // Logc logs a string returned by the closure at the given log level, using the caller as
 // its source.  If no log message would be written, the closure is never called.
-func (log Logger) Logc(lvl level, closure func() string) {
-	log.intLog(lvl, closure)
+func (log *Logger) Logc(lvl Level, closure func() string) {
+	log.intLog(nil, lvl, nil, closure)
 }
 
 // Finest logs a message at the finest log level.
 // See Debug for an explanation of the arguments.
-func (log Logger) Finest(arg0 interface{}, args ...interface{}) {
-	log.intLog(FINEST, arg0, args...)
+func (log *Logger) Finest(arg0 interface{}, args ...interface{}) {
+	log.intLog(nil, FINEST, nil, arg0, args...)
 }
 
 // Fine logs a message at the fine log level.
 // See Debug for an explanation of the arguments.
-func (log Logger) Fine(arg0 interface{}, args ...interface{}) {
-	log.intLog(FINE, arg0, args...)
+func (log *Logger) Fine(arg0 interface{}, args ...interface{}) {
+	log.intLog(nil, FINE, nil, arg0, args...)
 }
 
 // Debug is a utility method for debug log messages.
 // The behavior of Debug depends on the first argument:
-// - arg0 is a string
-//   When given a string as the first argument, this behaves like Logf but with
-//   the DEBUG log level: the first argument is interpreted as a format for the
-//   latter arguments.
-// - arg0 is a func()string
-//   When given a closure of type func()string, this logs the string returned by
-//   the closure iff it will be logged.  The closure runs at most one time.
-// - arg0 is interface{}
-//   When given anything else, the log message will be each of the arguments
-//   formatted with %v and separated by spaces (ala Sprint).
-func (log Logger) Debug(arg0 interface{}, args ...interface{}) {
-	log.intLog(DEBUG, arg0, args...)
+//   - arg0 is a string
+//     When given a string as the first argument, this behaves like Logf but with
+//     the DEBUG log level: the first argument is interpreted as a format for the
+//     latter arguments.
+//   - arg0 is a func()string
+//     When given a closure of type func()string, this logs the string returned by
+//     the closure iff it will be logged.  The closure runs at most one time.
+//   - arg0 is interface{}
+//     When given anything else, the log message will be each of the arguments
+//     formatted with %v and separated by spaces (ala Sprint).
+func (log *Logger) Debug(arg0 interface{}, args ...interface{}) {
+	log.intLog(nil, DEBUG, nil, arg0, args...)
 }
 
 // Trace logs a message at the trace log level.
 // See Debug for an explanation of the arguments.
-func (log Logger) Trace(arg0 interface{}, args ...interface{}) {
-	log.intLog(TRACE, arg0, args...)
+func (log *Logger) Trace(arg0 interface{}, args ...interface{}) {
+	log.intLog(nil, TRACE, nil, arg0, args...)
 }
 
 // Info logs a message at the info log level.
 // See Debug for an explanation of the arguments.
-func (log Logger) Info(arg0 interface{}, args ...interface{}) {
-	log.intLog(INFO, arg0, args...)
+func (log *Logger) Info(arg0 interface{}, args ...interface{}) {
+	log.intLog(nil, INFO, nil, arg0, args...)
 }
 
 // Warn logs a message at the warning log level and returns the formatted error.
@@ -345,20 +755,118 @@ func (log Logger) Info(arg0 interface{}, args ...interface{}) {
 // message is not actually logged, because all formats are processed and all
 // closures are executed to format the error message.
 // See Debug for further explanation of the arguments.
-func (log Logger) Warn(arg0 interface{}, args ...interface{}) error {
-	return log.intLog(WARNING, arg0, args...)
+func (log *Logger) Warn(arg0 interface{}, args ...interface{}) error {
+	return log.intLog(nil, WARNING, nil, arg0, args...)
 }
 
 // Error logs a message at the error log level and returns the formatted error,
 // See Warn for an explanation of the performance and Debug for an explanation
 // of the parameters.
-func (log Logger) Error(arg0 interface{}, args ...interface{}) error {
-	return log.intLog(ERROR, arg0, args...)
+func (log *Logger) Error(arg0 interface{}, args ...interface{}) error {
+	return log.intLog(nil, ERROR, nil, arg0, args...)
 }
 
 // Critical logs a message at the critical log level and returns the formatted error,
 // See Warn for an explanation of the performance and Debug for an explanation
 // of the parameters.
-func (log Logger) Critical(arg0 interface{}, args ...interface{}) error {
-	return log.intLog(CRITICAL, arg0, args...)
+func (log *Logger) Critical(arg0 interface{}, args ...interface{}) error {
+	return log.intLog(nil, CRITICAL, nil, arg0, args...)
+}
+
+// Finestw logs msg at the finest log level with the given alternating keys and
+// values attached to the record.
+func (log *Logger) Finestw(msg string, kv ...interface{}) {
+	log.intLog(nil, FINEST, kvToFields(kv), msg)
+}
+
+// Finew logs msg at the fine log level with the given alternating keys and
+// values attached to the record.
+func (log *Logger) Finew(msg string, kv ...interface{}) {
+	log.intLog(nil, FINE, kvToFields(kv), msg)
+}
+
+// Debugw logs msg at the debug log level with the given alternating keys and
+// values attached to the record, e.g. log.Debugw("cache miss", "key", k).
+// The message is written as is and is not used as a format.
+func (log *Logger) Debugw(msg string, kv ...interface{}) {
+	log.intLog(nil, DEBUG, kvToFields(kv), msg)
+}
+
+// Tracew logs msg at the trace log level with the given alternating keys and
+// values attached to the record.
+func (log *Logger) Tracew(msg string, kv ...interface{}) {
+	log.intLog(nil, TRACE, kvToFields(kv), msg)
+}
+
+// Infow logs msg at the info log level with the given alternating keys and
+// values attached to the record.
+func (log *Logger) Infow(msg string, kv ...interface{}) {
+	log.intLog(nil, INFO, kvToFields(kv), msg)
+}
+
+// Warnw logs msg at the warning log level with the given alternating keys and
+// values attached to the record, and returns msg as an error.
+func (log *Logger) Warnw(msg string, kv ...interface{}) error {
+	return log.intLog(nil, WARNING, kvToFields(kv), msg)
+}
+
+// Errorw logs msg at the error log level with the given alternating keys and
+// values attached to the record, and returns msg as an error.
+func (log *Logger) Errorw(msg string, kv ...interface{}) error {
+	return log.intLog(nil, ERROR, kvToFields(kv), msg)
+}
+
+// Criticalw logs msg at the critical log level with the given alternating keys
+// and values attached to the record, and returns msg as an error.
+func (log *Logger) Criticalw(msg string, kv ...interface{}) error {
+	return log.intLog(nil, CRITICAL, kvToFields(kv), msg)
+}
+
+// FinestCtx logs a message at the finest log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLog(ctx, FINEST, nil, arg0, args...)
+}
+
+// FineCtx logs a message at the fine log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLog(ctx, FINE, nil, arg0, args...)
+}
+
+// DebugCtx logs a message at the debug log level, attaching the fields found
+// in ctx by the registered ContextExtractors to the record.
+// See Debug for an explanation of the remaining arguments.
+func (log *Logger) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLog(ctx, DEBUG, nil, arg0, args...)
+}
+
+// TraceCtx logs a message at the trace log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLog(ctx, TRACE, nil, arg0, args...)
+}
+
+// InfoCtx logs a message at the info log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLog(ctx, INFO, nil, arg0, args...)
+}
+
+// WarnCtx logs a message at the warning log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return log.intLog(ctx, WARNING, nil, arg0, args...)
+}
+
+// ErrorCtx logs a message at the error log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return log.intLog(ctx, ERROR, nil, arg0, args...)
+}
+
+// CriticalCtx logs a message at the critical log level with the fields found in ctx.
+// See DebugCtx for an explanation of the arguments.
+func (log *Logger) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return log.intLog(ctx, CRITICAL, nil, arg0, args...)
 }
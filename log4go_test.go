@@ -10,22 +10,32 @@
 package log4go
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	stdlog "log"
+	"net/http/httptest"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 const testLogFile = "_logtest.log"
 
 var now time.Time = time.Unix(0, 1234567890123456789).In(time.UTC)
 
-func newLogRecord(lvl level, src string, msg string) *LogRecord {
+func newLogRecord(lvl Level, src string, msg string) *LogRecord {
 	return &LogRecord{
 		Level:   lvl,
 		Source:  src,
@@ -68,6 +78,20 @@ var formatTests = []struct {
 			FORMAT_ABBREV:  "[EROR] message\n",
 		},
 	},
+	{
+		Test: "Fields",
+		Record: &LogRecord{
+			Level:   INFO,
+			Source:  "source",
+			Message: "message",
+			Created: now,
+			Fields:  Fields{{"user", 42}, {"path", "/a b"}},
+		},
+		Formats: map[string]string{
+			FORMAT_ABBREV: "[INFO] message user=42 path=\"/a b\"\n",
+			"%M%X":        "message<field name=\"user\">42</field><field name=\"path\">/a b</field>\n",
+		},
+	},
 }
 
 func TestFormatLogRecord(t *testing.T) {
@@ -83,6 +107,133 @@ func TestFormatLogRecord(t *testing.T) {
 	}
 }
 
+func TestPattern(t *testing.T) {
+	rec := &LogRecord{Level: WARNING, Source: "source", Message: "message", Created: now.Add(5)}
+	for format, want := range map[string]string{
+		"%L 100%% %M":      "WARN 100% message\n",
+		"%N %N":            "23:31:30.123456794 UTC 23:31:30.123456794 UTC\n",
+		"%d %T":            "02/13/09 23:31:30 UTC\n",
+		"":                 "",
+		"%C%F%K%X literal": " literal\n",
+	} {
+		p, err := CompilePattern(format)
+		if err != nil {
+			t.Errorf("CompilePattern(%q): %s", format, err)
+			continue
+		}
+		if got := p.Format(rec); got != want || p.String() != format {
+			t.Errorf("%q: got %q, want %q", format, got, want)
+		}
+	}
+
+	// The timestamps are formatted again for another second or location
+	p := MustCompilePattern("%T")
+	later := &LogRecord{Created: now.Add(time.Second + 6)}
+	paris := &LogRecord{Created: later.Created.In(time.FixedZone("CET", 3600))}
+	if got := p.Format(rec) + p.Format(later) + p.Format(paris) + p.Format(later); got != "23:31:30 UTC\n23:31:31 UTC\n00:31:31 CET\n23:31:31 UTC\n" {
+		t.Errorf("timestamps: %q", got)
+	}
+	p = MustCompilePattern("%N")
+	if got := p.Format(rec) + p.Format(&LogRecord{Created: now}); got != "23:31:30.123456794 UTC\n23:31:30.123456789 UTC\n" {
+		t.Errorf("nanoseconds: %q", got)
+	}
+
+	// Invalid formats are reported when compiled, and their codes ignored by
+	// FormatLogRecord and the writers
+	for format, want := range map[string]string{
+		"[%L] %Q%M": `log4go: unknown code %Q at offset 5 of format "[%L] %Q%M"`,
+		"%M 100%":   `log4go: format "%M 100%" ends with %`,
+	} {
+		if _, err := CompilePattern(format); err == nil || err.Error() != want {
+			t.Errorf("CompilePattern(%q): %v, want %s", format, err, want)
+		}
+	}
+	if got := FormatLogRecord("[%L] %Q%M", rec); got != "[WARN] message\n" {
+		t.Errorf("FormatLogRecord: %q", got)
+	}
+	var errs []*WriterError
+	w := NewConsoleLogWriter()
+	w.SetErrorHandler(func(err *WriterError) { errs = append(errs, err) })
+	w.SetFormat("%M%Q")
+	w.Close()
+	if len(errs) != 1 || errs[0].Op != "format" || w.RecordParts() != 0 {
+		t.Errorf("SetFormat errors: %v", errs)
+	}
+
+	// The format of a configuration is handled like SetFormat's
+	errs = nil
+	l := NewLogger()
+	l.SetErrorHandler(func(err *WriterError) { errs = append(errs, err) })
+	defer os.Remove(testLogFile)
+	err := l.loadXmlConfiguration([]byte(`<logging>
+  <filter enabled="true">
+    <tag>file</tag>
+    <type>file</type>
+    <level>INFO</level>
+    <property name="filename">` + testLogFile + `</property>
+    <property name="format">[%L] %Q%M</property>
+  </filter>
+</logging>`))
+	l.Info("configured")
+	l.Close()
+	if err != nil || len(errs) != 1 || errs[0].Op != "format" {
+		t.Errorf("configuration errors: %v, %v", err, errs)
+	}
+	if contents, _ := ioutil.ReadFile(testLogFile); string(contents) != "[INFO] configured\n" {
+		t.Errorf("configured format wrote %q", contents)
+	}
+}
+
+func TestFormatCodes(t *testing.T) {
+	caller := &Caller{Function: "github.com/gojuno/log4go.(*Logger).Info", File: "/src/log4go/wrapper.go", Line: 42}
+	rec := &LogRecord{Message: "message", Created: processStart.Add(1500 * time.Millisecond), Caller: caller, Goroutine: 7, Seq: 9}
+	for format, want := range map[string]string{
+		"%f:%l %m %P":    "wrapper.go:42 (*Logger).Info github.com/gojuno/log4go\n",
+		"[%g] #%i +%rms": "[7] #9 +1500ms\n",
+		"%e[%p]@%h":      processName + "[" + processID + "]@" + hostname + "\n",
+		"(%f:%l%m%P) %M": "(:) message\n",
+	} {
+		r := rec
+		if strings.HasPrefix(format, "(") {
+			r = &LogRecord{Message: "message"}
+		}
+		if got := MustCompilePattern(format).Format(r); got != want {
+			t.Errorf("%q: got %q, want %q", format, got, want)
+		}
+	}
+
+	// The Loggers record the caller, goroutine and sequence number
+	l := NewLogger()
+	w := &partialWriter{parts: PART_SOURCE | PART_GOROUTINE}
+	l.AddFilter("codes", INFO, w)
+	l.Info("first")
+	l.Info("second")
+	first, second := w.recs[0], w.recs[1]
+	if c := first.Caller; c == nil || c.ShortFile() != "log4go_test.go" || c.FuncName() != "TestFormatCodes" || c.Package() != "github.com/gojuno/log4go" || c.String() != first.Source {
+		t.Errorf("caller: %+v", c)
+	}
+	if first.Goroutine == 0 || first.Goroutine != second.Goroutine || second.Seq <= first.Seq {
+		t.Errorf("goroutine %d, %d, sequence %d, %d", first.Goroutine, second.Goroutine, first.Seq, second.Seq)
+	}
+	l.AddFilter("none", INFO, &partialWriter{})
+	if l.Info("third"); w.recs[2].Goroutine == 0 {
+		t.Errorf("goroutine not looked up")
+	}
+	l = NewLogger()
+	none := &partialWriter{}
+	l.AddFilter("none", INFO, none)
+	if l.Info("fourth"); none.recs[0].Goroutine != 0 || none.recs[0].Caller != nil {
+		t.Errorf("computed unused parts: %+v", none.recs[0])
+	}
+
+	// Writers which do not report their parts get the default ones
+	all := &recordingWriter{}
+	l.AddFilter("all", INFO, all)
+	if l.Info("fifth"); all.recs[0].Goroutine != 0 || all.recs[0].Caller == nil {
+		t.Errorf("default parts: %+v", all.recs[0])
+	}
+}
+
 var logRecordWriteTests = []struct {
 	Test    string
 	Record  *LogRecord
@@ -96,12 +247,15 @@ var logRecordWriteTests = []struct {
 			Message: "message",
 			Created: now,
 		},
-		Console: "[02/13/09 23:31:30] [CRIT] message\n",
+		Console: "[02/13/09 23:31:30 UTC] [CRIT] message\n",
 	},
 }
 
 func TestConsoleLogWriter(t *testing.T) {
-	console := make(ConsoleLogWriter)
+	console := &ConsoleLogWriter{
+		recordQueue: newRecordQueue(0),
+		pattern:     MustCompilePattern("[%d %T] [%L] %M"),
+	}
 
 	r, w := io.Pipe()
 	go console.run(w)
@@ -122,6 +276,76 @@ func TestConsoleLogWriter(t *testing.T) {
 	}
 }
 
+func TestFieldLogger(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	l := NewLogger()
+	l.AddFilter("file", FINEST, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %M%F"))
+	defer os.Remove(testLogFile)
+
+	reqLog := l.With("request", "r1")
+	reqLog.With("user", 7).Info("hello %s", "world")
+	reqLog.Warnw("slow", "ms", 250, "dangling")
+	l.Infow("100% done", "job", "a=b")
+	if got := reqLog.Fields().String(); got != "request=r1" {
+		t.Errorf("With modified the parent fields: %q", got)
+	}
+	l.Close()
+
+	want := "[INFO] hello world request=r1 user=7\n" +
+		"[WARN] slow request=r1 ms=250 !BADKEY=dangling\n" +
+		"[INFO] 100% done job=\"a=b\"\n"
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if got := string(contents); got != want {
+		t.Errorf("got %q", got)
+		t.Errorf("want %q", want)
+	}
+
+	js, err := json.Marshal(&LogRecord{Level: INFO, Message: "m", Fields: Fields{{"b", 1}, {"a", make(chan int)}}})
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+	if want := `"Fields":{"b":1,"a":"0x`; !strings.Contains(string(js), want) {
+		t.Errorf("json: %s does not contain %s", js, want)
+	}
+}
+
+type testTraceKey struct{}
+
+func TestContextLogging(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	RegisterContextExtractor(ContextValueExtractor("trace", testTraceKey{}))
+
+	l := NewLogger()
+	l.AddFilter("file", FINEST, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %M%F"))
+	defer os.Remove(testLogFile)
+
+	ctx := context.WithValue(context.Background(), testTraceKey{}, "t-1")
+	ctx = ContextWithFields(ctx, "request", "r1")
+	l.InfoCtx(ctx, "hello %s", "world")
+	l.With("user", 7).WarnCtx(ContextWithFields(ctx, "step", 2), "slow")
+	l.DebugCtx(context.Background(), "plain")
+	l.Close()
+
+	want := "[INFO] hello world request=r1 trace=t-1\n" +
+		"[WARN] slow user=7 request=r1 step=2 trace=t-1\n" +
+		"[DEBG] plain\n"
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if got := string(contents); got != want {
+		t.Errorf("got %q", got)
+		t.Errorf("want %q", want)
+	}
+}
+
 func TestFileLogWriter(t *testing.T) {
 	defer func(buflen int) {
 		LogBufferLength = buflen
@@ -173,26 +397,28 @@ func TestLogger(t *testing.T) {
 	if sl == nil {
 		t.Fatalf("NewDefaultLogger should never return nil")
 	}
-	if lw, exist := sl["stdout"]; lw == nil || exist != true {
+	filters := sl.Filters()
+	if lw, exist := filters["stdout"]; lw.LogWriter == nil || exist != true {
 		t.Fatalf("NewDefaultLogger produced invalid logger (DNE or nil)")
 	}
-	if sl["stdout"].Level != WARNING {
+	if filters["stdout"].Level != WARNING {
 		t.Fatalf("NewDefaultLogger produced invalid logger (incorrect level)")
 	}
-	if len(sl) != 1 {
+	if len(filters) != 1 {
 		t.Fatalf("NewDefaultLogger produced invalid logger (incorrect map count)")
 	}
 
 	//func (l *Logger) AddFilter(name string, level int, writer LogWriter) {}
-	l := make(Logger)
+	l := NewLogger()
 	l.AddFilter("stdout", DEBUG, NewConsoleLogWriter())
-	if lw, exist := l["stdout"]; lw == nil || exist != true {
+	filters = l.Filters()
+	if lw, exist := filters["stdout"]; lw.LogWriter == nil || exist != true {
 		t.Fatalf("AddFilter produced invalid logger (DNE or nil)")
 	}
-	if l["stdout"].Level != DEBUG {
+	if filters["stdout"].Level != DEBUG {
 		t.Fatalf("AddFilter produced invalid logger (incorrect level)")
 	}
-	if len(l) != 1 {
+	if len(filters) != 1 {
 		t.Fatalf("AddFilter produced invalid logger (incorrect map count)")
 	}
 
@@ -222,9 +448,1247 @@ func TestLogger(t *testing.T) {
 	//func (l *Logger) Info(format string, args ...interface{}) {}
 }
 
+// A LogWriter recording what it was sent, for tests
+type recordingWriter struct {
+	mu          sync.Mutex
+	recs        []*LogRecord
+	closed      bool
+	writeClosed bool
+}
+
+func (w *recordingWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		w.writeClosed = true
+	}
+	w.recs = append(w.recs, rec)
+}
+
+func (w *recordingWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+}
+
+func TestLoggerReconfiguration(t *testing.T) {
+	l := NewLogger()
+	first := &recordingWriter{}
+	l.AddFilter("rec", INFO, first)
+
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					l.Info("message")
+				}
+			}
+		}()
+	}
+
+	var writers []*recordingWriter
+	for i := 0; i < 50; i++ {
+		w := &recordingWriter{}
+		writers = append(writers, w)
+		l.ReplaceFilter("rec", INFO, w)
+		l.AddFilter("extra", DEBUG, &recordingWriter{})
+		l.RemoveFilter("extra")
+		l.Filters()
+	}
+	close(stop)
+	wg.Wait()
+
+	if !first.closed {
+		t.Errorf("ReplaceFilter did not close the replaced writer")
+	}
+	for i, w := range append([]*recordingWriter{first}, writers...) {
+		if w.writeClosed {
+			t.Errorf("writer %d was written to after Close", i)
+		}
+	}
+	if l.RemoveFilter("extra") {
+		t.Errorf("RemoveFilter reported removing a filter which does not exist")
+	}
+	if filters := l.Filters(); len(filters) != 1 || filters["rec"].LogWriter != writers[len(writers)-1] {
+		t.Errorf("Filters returned %v", filters)
+	}
+	l.Close()
+	if len(l.Filters()) != 0 {
+		t.Errorf("Close did not remove the filters")
+	}
+}
+
+// A LogWriter blocking in LogWrite until released, for tests
+type blockingWriter struct {
+	recordingWriter
+	entered, release chan bool
+}
+
+func (w *blockingWriter) LogWrite(rec *LogRecord) {
+	w.entered <- true
+	<-w.release
+	w.recordingWriter.LogWrite(rec)
+}
+
+func TestBlockedWriter(t *testing.T) {
+	l := NewLogger()
+	blocked := &blockingWriter{entered: make(chan bool), release: make(chan bool)}
+	l.AddFilter("blocked", INFO, blocked)
+	go l.Info("message")
+	<-blocked.entered
+
+	// The other filters can change while a writer blocks
+	changed := make(chan bool)
+	go func() {
+		l.ReplaceFilter("other", INFO, &recordingWriter{})
+		l.SetLevel("blocked", WARNING)
+		l.RemoveFilter("other")
+		close(changed)
+	}()
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("changing the filters waited for a blocked writer")
+	}
+
+	// Its own removal waits for the record to be handed over
+	removed := make(chan bool)
+	go func() {
+		l.RemoveFilter("blocked")
+		close(removed)
+	}()
+	select {
+	case <-removed:
+		t.Errorf("RemoveFilter closed a writer which was being written to")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(blocked.release)
+	<-removed
+	if !blocked.closed || blocked.writeClosed || len(blocked.recs) != 1 {
+		t.Errorf("closed %v, written after close %v, %d records", blocked.closed, blocked.writeClosed, len(blocked.recs))
+	}
+
+	// A writer which stopped does not block the Logger
+	w := NewFormatLogWriter(ioutil.Discard, "%M")
+	w.close()
+	w.records = make(chan *LogRecord)
+	l.AddFilter("stopped", INFO, w)
+	l.Info("not written")
+	if w.Dropped() != 1 {
+		t.Errorf("dropped %d records written to a stopped writer", w.Dropped())
+	}
+}
+
+// A recordingWriter which uses only some of the costly record parts
+type partialWriter struct {
+	recordingWriter
+	parts RecordPart
+}
+
+func (w *partialWriter) RecordParts() RecordPart {
+	return w.parts
+}
+
+func TestRecordParts(t *testing.T) {
+	l := NewLogger()
+	none := &partialWriter{}
+	l.AddFilter("none", FINEST, none)
+
+	l.Error("nothing costly")
+	if rec := none.recs[0]; rec.Source != "" || rec.Stack != "" {
+		t.Errorf("computed unused parts: %q %q", rec.Source, rec.Stack)
+	}
+
+	source := &partialWriter{parts: PART_SOURCE}
+	l.AddFilter("source", INFO, source)
+	l.Error("with source")
+	if rec := source.recs[0]; !strings.HasPrefix(rec.Source, "github.com/gojuno/log4go.TestRecordParts:") || rec.Stack != "" {
+		t.Errorf("wrong parts: %q %q", rec.Source, rec.Stack)
+	}
+	l.Debug("only the first filter")
+	if rec := none.recs[2]; rec.Source != "" {
+		t.Errorf("computed source for a filter which does not use it: %q", rec.Source)
+	}
+
+	for format, want := range map[string]RecordPart{
+		FORMAT_DEFAULT: PART_SOURCE | PART_STACK,
+		FORMAT_SHORT:   0,
+		"%S %M":        PART_SOURCE,
+		"%M%X":         PART_STACK,
+		"%f:%l %M":     PART_SOURCE,
+		"[%g] %M":      PART_GOROUTINE,
+	} {
+		if got := MustCompilePattern(format).RecordParts(); got != want {
+			t.Errorf("RecordParts(%q) = %d, want %d", format, got, want)
+		}
+	}
+}
+
+func TestSamplingLogWriter(t *testing.T) {
+	rec := &recordingWriter{}
+	w := NewSamplingLogWriter(rec, 2, 3, time.Hour)
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Source: "a.go:1", Message: fmt.Sprint("a", i)})
+	}
+	w.LogWrite(&LogRecord{Level: ERROR, Created: now, Source: "a.go:1", Message: "other level"})
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Source: "b.go:1", Message: "other source"})
+	w.LogWrite(&LogRecord{Level: INFO, Created: now.Add(time.Hour), Source: "a.go:1", Message: "next interval"})
+	w.Close()
+
+	var got []string
+	for _, r := range rec.recs {
+		got = append(got, r.Message)
+	}
+	want := []string{"a0", "a1", "a4", "a7", "other level", "other source", "next interval",
+		"6 similar records suppressed by sampling"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sampled records:\n got %q\nwant %q", got, want)
+	}
+	if !rec.closed {
+		t.Errorf("wrapped writer not closed")
+	}
+	if last := rec.recs[len(rec.recs)-1]; last.Level != INFO || last.Source != "a.go:1" {
+		t.Errorf("summary for the wrong group: %v %q", last.Level, last.Source)
+	}
+
+	if parts := NewSamplingLogWriter(&partialWriter{}, 1, 0, 0).RecordParts(); parts != PART_SOURCE {
+		t.Errorf("RecordParts = %d, want %d", parts, PART_SOURCE)
+	}
+
+	l := NewLogger()
+	err := l.loadXmlConfiguration([]byte(`<logging>
+  <filter enabled="true">
+    <tag>stdout</tag>
+    <type>console</type>
+    <level>INFO</level>
+    <property name="samplefirst">10</property>
+    <property name="sampleinterval">100ms</property>
+  </filter>
+</logging>`))
+	if err != nil {
+		t.Fatalf("loadXmlConfiguration: %s", err)
+	}
+	if sw, ok := l.Filters()["stdout"].LogWriter.(*SamplingLogWriter); !ok || sw.first != 10 || sw.thereafter != 0 || sw.interval != 100*time.Millisecond {
+		t.Errorf("sampling not configured: %#v", l.Filters()["stdout"].LogWriter)
+	}
+	l.Close()
+}
+
+func TestDedupLogWriter(t *testing.T) {
+	rec := &recordingWriter{}
+	w := NewDedupLogWriter(rec, 50*time.Millisecond)
+
+	now := time.Now()
+	write := func(lvl Level, src, msg string) {
+		w.LogWrite(&LogRecord{Level: lvl, Created: now, Source: src, Message: msg})
+	}
+	messages := func() string {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		var got []string
+		for _, r := range rec.recs {
+			got = append(got, r.Message)
+		}
+		return strings.Join(got, "|")
+	}
+
+	for i := 0; i < 4; i++ {
+		write(ERROR, "a.go:1", "down")
+	}
+	write(ERROR, "a.go:1", "up")
+	write(ERROR, "a.go:1", "up")
+	write(WARNING, "a.go:1", "up")
+	write(WARNING, "b.go:1", "up")
+	if want := "down|last message repeated 3 times|up|last message repeated once|up|up"; messages() != want {
+		t.Errorf("got %q, want %q", messages(), want)
+	}
+
+	write(WARNING, "b.go:1", "up")
+	write(WARNING, "b.go:1", "up")
+	time.Sleep(200 * time.Millisecond)
+	if want := "|up|last message repeated 2 times"; !strings.HasSuffix(messages(), want) {
+		t.Errorf("repetitions not reported after the timeout: %q", messages())
+	}
+
+	write(WARNING, "b.go:1", "up")
+	w.Close()
+	if want := "|last message repeated 2 times|last message repeated once"; !strings.HasSuffix(messages(), want) || !rec.closed {
+		t.Errorf("repetitions not reported on Close: %q", messages())
+	}
+}
+
+func TestRingLogWriter(t *testing.T) {
+	rec := &recordingWriter{}
+	w := NewRingLogWriter(rec, 3, ERROR)
+	messages := func() string {
+		var got []string
+		for _, r := range rec.recs {
+			got = append(got, r.Message)
+		}
+		return strings.Join(got, "|")
+	}
+
+	for i := 0; i < 5; i++ {
+		w.LogWrite(&LogRecord{Level: DEBUG, Message: fmt.Sprintf("d%d", i)})
+	}
+	if w.Len() != 3 || len(rec.recs) != 0 {
+		t.Errorf("kept %d records and wrote %d, want 3 and 0", w.Len(), len(rec.recs))
+	}
+	w.LogWrite(&LogRecord{Level: ERROR, Message: "e1"})
+	w.LogWrite(&LogRecord{Level: INFO, Message: "i5"})
+	w.LogWrite(&LogRecord{Level: CRITICAL, Message: "c1"})
+	w.LogWrite(&LogRecord{Level: FINE, Message: "lost"})
+	if got, want := messages(), "d2|d3|d4|e1|i5|c1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	w.Close()
+	if w.Len() != 0 || !rec.closed {
+		t.Errorf("Close did not discard the records or close the writer")
+	}
+
+	yamlConfig := []byte(`
+logging:
+  ring:
+    enabled: true
+    type: ring
+    level: FINEST
+    properties:
+      target: file
+      filename: ` + testLogFile + `
+      format: "[%L] %M"
+      ringsize: 2
+      trigger: WARNING
+`)
+	xmlConfig := []byte(`<logging>
+  <filter enabled="true">
+    <tag>ring</tag>
+    <type>ring</type>
+    <level>FINEST</level>
+    <property name="target">file</property>
+    <property name="filename">` + testLogFile + `</property>
+    <property name="format">[%L] %M</property>
+    <property name="ringsize">2</property>
+    <property name="trigger">WARNING</property>
+  </filter>
+</logging>`)
+	for _, test := range []struct {
+		Name string
+		Load func(*Logger) error
+	}{
+		{"yaml", func(l *Logger) error { return l.loadYamlConfiguration(yamlConfig) }},
+		{"xml", func(l *Logger) error { return l.loadXmlConfiguration(xmlConfig) }},
+	} {
+		l := NewLogger()
+		if err := test.Load(l); err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+		l.Finest("one")
+		l.Debug("two")
+		l.Info("three")
+		l.Warn("warned")
+		l.Info("kept")
+		l.Close()
+
+		want := "[DEBG] two\n[INFO] three\n[WARN] warned\n"
+		if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+			t.Errorf("%s: read(%q): %s", test.Name, testLogFile, err)
+		} else if got := string(contents); got != want {
+			t.Errorf("%s: got %q, want %q", test.Name, got, want)
+		}
+		os.Remove(testLogFile)
+	}
+
+	if err := NewLogger().loadXmlConfiguration([]byte(`<logging><filter><tag>x</tag><type>ring</type><level>INFO</level><property name="target">ring</property></filter></logging>`)); err == nil {
+		t.Errorf("ring target accepted by the configuration")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	l := NewLogger()
+	all, nethttp, quiet := &partialWriter{}, &partialWriter{}, &partialWriter{}
+	l.AddFilter("all", FINEST, all)
+	l.AddFilter("nethttp", FINEST, nethttp)
+	l.AddFilter("quiet", FINEST, quiet)
+
+	src, _ := MatchSource("net/http.*")
+	health, _ := MatchMessage("^health check")
+	reqField, _ := MatchField("path", "^/api/")
+	l.SetMatch("nethttp", src)
+	l.SetMatch("quiet", All(LevelRange(DEBUG, WARNING), Not(health), Any(reqField, Not(src))))
+
+	l.Log(INFO, "net/http.(*conn).serve:1", "serving")
+	l.Log(INFO, "main.main:1", "health check ok")
+	l.Log(ERROR, "main.main:2", "failed")
+	l.Infow("request", "path", "/api/users")
+	l.Fine("too fine")
+
+	messages := func(w *partialWriter) string {
+		var got []string
+		for _, rec := range w.recs {
+			got = append(got, rec.Message)
+		}
+		return strings.Join(got, "|")
+	}
+	if got, want := messages(all), "serving|health check ok|failed|request|too fine"; got != want {
+		t.Errorf("all: got %q, want %q", got, want)
+	}
+	if got, want := messages(nethttp), "serving"; got != want {
+		t.Errorf("nethttp: got %q, want %q", got, want)
+	}
+	if got, want := messages(quiet), "request"; got != want {
+		t.Errorf("quiet: got %q, want %q", got, want)
+	}
+	if rec := all.recs[3]; rec.Source == "" {
+		t.Errorf("source not computed for a filter with a predicate")
+	}
+
+	if _, err := MatchMessage("("); err == nil {
+		t.Errorf("MatchMessage accepted an invalid expression")
+	}
+	if p, _ := MatchSource("main.?ain:*"); !p(&LogRecord{Source: "main.main:12"}) || p(&LogRecord{Source: "xmain.main:12"}) {
+		t.Errorf("MatchSource glob not anchored or not expanded")
+	}
+
+	yamlConfig := []byte(`
+logging:
+  stdout:
+    enabled: true
+    type: console
+    level: DEBUG
+    maxlevel: WARNING
+    excludemessage: "^health check"
+`)
+	xmlConfig := []byte(`<logging>
+  <filter enabled="true">
+    <tag>stdout</tag>
+    <type>console</type>
+    <level>DEBUG</level>
+    <maxlevel>WARNING</maxlevel>
+    <excludemessage>^health check</excludemessage>
+  </filter>
+</logging>`)
+	for _, test := range []struct {
+		Name string
+		Load func(*Logger) error
+	}{
+		{"yaml", func(l *Logger) error { return l.loadYamlConfiguration(yamlConfig) }},
+		{"xml", func(l *Logger) error { return l.loadXmlConfiguration(xmlConfig) }},
+	} {
+		l := NewLogger()
+		if err := test.Load(l); err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+		match := l.Filters()["stdout"].Match
+		if match == nil {
+			t.Fatalf("%s: no predicate configured", test.Name)
+		}
+		if !match(&LogRecord{Level: INFO, Message: "ok"}) || match(&LogRecord{Level: ERROR, Message: "ok"}) ||
+			match(&LogRecord{Level: INFO, Message: "health check"}) {
+			t.Errorf("%s: predicate does not select the configured records", test.Name)
+		}
+		l.Close()
+	}
+
+	if err := NewLogger().loadXmlConfiguration([]byte(`<logging><filter><tag>x</tag><type>console</type><level>INFO</level><message>(</message></filter></logging>`)); err == nil {
+		t.Errorf("invalid message expression accepted by the configuration")
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	drain := func(q *recordQueue) string {
+		var got []string
+		for len(q.records) > 0 {
+			got = append(got, (<-q.records).Message)
+		}
+		return strings.Join(got, "|")
+	}
+	put := func(q *recordQueue, msgs ...string) {
+		for _, msg := range msgs {
+			q.put(&LogRecord{Level: INFO, Message: msg})
+		}
+	}
+
+	for _, test := range []struct {
+		Policy OverflowPolicy
+		Want   string
+	}{
+		{OVERFLOW_DROP_NEWEST, "1|2"},
+		{OVERFLOW_DROP_OLDEST, "2|3"},
+		{OVERFLOW_BLOCK_TIMEOUT, "1|2"},
+	} {
+		q := newRecordQueue(2)
+		q.SetOverflowPolicy(test.Policy, 10*time.Millisecond)
+		put(&q, "1", "2", "3")
+		if got := drain(&q); got != test.Want || q.Dropped() != 1 {
+			t.Errorf("policy %d: got %q, %d dropped; want %q, 1 dropped", test.Policy, got, q.Dropped(), test.Want)
+		}
+	}
+
+	q := newRecordQueue(2)
+	q.SetOverflowPolicy(OVERFLOW_DROP_NEWEST, 0)
+	q.SetDropReport(true)
+	put(&q, "1", "2", "3", "4")
+	drain(&q)
+	put(&q, "5")
+	if got, want := drain(&q), "5|2 records dropped"; got != want || q.Dropped() != 2 {
+		t.Errorf("drop report: got %q, %d dropped; want %q", got, q.Dropped(), want)
+	}
+
+	q = newRecordQueue(1)
+	put(&q, "1")
+	done := make(chan bool)
+	go func() {
+		put(&q, "2")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Errorf("OVERFLOW_BLOCK did not block")
+	case <-time.After(10 * time.Millisecond):
+	}
+	<-q.records
+	<-done
+	if got := drain(&q); got != "2" || q.Dropped() != 0 {
+		t.Errorf("OVERFLOW_BLOCK: got %q, %d dropped", got, q.Dropped())
+	}
+
+	l := NewLogger()
+	err := l.loadXmlConfiguration([]byte(`<logging>
+  <filter enabled="true">
+    <tag>stdout</tag>
+    <type>console</type>
+    <level>INFO</level>
+    <property name="overflow">blocktimeout</property>
+    <property name="overflowtimeout">5ms</property>
+    <property name="dropreport">true</property>
+  </filter>
+</logging>`))
+	if err != nil {
+		t.Fatalf("loadXmlConfiguration: %s", err)
+	}
+	if w := l.Filters()["stdout"].LogWriter.(*ConsoleLogWriter); w.policy != OVERFLOW_BLOCK_TIMEOUT || w.timeout != 5*time.Millisecond || !w.report {
+		t.Errorf("overflow policy not configured: %d %s %v", w.policy, w.timeout, w.report)
+	}
+	l.Close()
+}
+
+// A recordingWriter whose Flush waits to be released
+type stuckFlusher struct {
+	recordingWriter
+	release chan bool
+}
+
+func (w *stuckFlusher) Flush() {
+	<-w.release
+}
+
+func TestFlush(t *testing.T) {
+	l := NewLogger()
+	l.AddFilter("xml", FINEST, NewXMLLogWriter(testLogFile, false))
+	l.GetLogger("payments").AddFilter("file", FINEST, NewFileLogWriter(testLogFile+".2", false).SetFormat("%M"))
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".2")
+
+	for i := 0; i < 10; i++ {
+		l.Info("record %d", i)
+		l.GetLogger("payments").Info("payment %d", i)
+	}
+	if err := l.Flush(time.Second); err != nil {
+		t.Fatalf("Flush: %s", err)
+	}
+	if contents, _ := ioutil.ReadFile(testLogFile); strings.Count(string(contents), "<record") != 20 {
+		t.Errorf("records not written by Flush: %q", contents)
+	}
+	if contents, _ := ioutil.ReadFile(testLogFile + ".2"); strings.Count(string(contents), "payment") != 10 {
+		t.Errorf("named logger records not written by Flush: %q", contents)
+	}
+
+	l.Info("last record")
+	l.Close()
+	if contents, _ := ioutil.ReadFile(testLogFile); !strings.HasSuffix(string(contents), "last record</message>\n\t</record>\n</log>\n") {
+		t.Errorf("Close returned before the writer finished: %q", contents)
+	}
+
+	stuck := &stuckFlusher{release: make(chan bool)}
+	l.AddFilter("stuck", FINEST, stuck)
+	l.AddFilter("rec", FINEST, &recordingWriter{})
+	if err := l.Flush(10 * time.Millisecond); err == nil {
+		t.Errorf("Flush did not time out")
+	}
+	close(stuck.release)
+	if err := l.Flush(0); err != nil {
+		t.Errorf("Flush: %s", err)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	var mu sync.Mutex
+	var errs []*WriterError
+	collect := func(err *WriterError) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+	last := func() *WriterError {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(errs) == 0 {
+			return nil
+		}
+		return errs[len(errs)-1]
+	}
+
+	defer func(h ErrorHandler) {
+		DefaultErrorHandler = h
+	}(DefaultErrorHandler)
+	DefaultErrorHandler = collect
+
+	if w := NewFileLogWriter("/nonexistent/dir/test.log", false); w != nil {
+		t.Fatalf("NewFileLogWriter succeeded in a missing directory")
+	}
+	if err := last(); err == nil || err.Op != "open" || err.Writer != `FileLogWriter("/nonexistent/dir/test.log")` {
+		t.Errorf("open failure not reported to DefaultErrorHandler: %+v", err)
+	}
+	DefaultErrorHandler = func(err *WriterError) {
+		t.Errorf("error reported to DefaultErrorHandler: %s", err)
+	}
+
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("needs /dev/full to make writes fail")
+	}
+	l := NewLogger()
+	l.SetErrorHandler(collect)
+	l.GetLogger("payments").AddFilter("full", INFO, NewFileLogWriter("/dev/full", false))
+	l.GetLogger("payments").Info("lost record")
+	l.Flush(time.Second)
+	if err := last(); err == nil || err.Op != "write" || err.Record == nil || err.Record.Message != "lost record" ||
+		err.Error() != `FileLogWriter("/dev/full"): write /dev/full: no space left on device` {
+		t.Errorf("write failure not reported to the root logger's handler: %+v", err)
+	}
+
+	var own *WriterError
+	w := NewFileLogWriter("/dev/full", false)
+	w.SetErrorHandler(func(err *WriterError) { own = err })
+	l.AddFilter("own", INFO, NewDedupLogWriter(w, 0))
+	l.RemoveFilter("full")
+	count := len(errs)
+	l.Info("lost again")
+	l.Close()
+	if own == nil || own.Record.Message != "lost again" || len(errs) != count {
+		t.Errorf("error not reported to the writer's own handler: %+v", own)
+	}
+
+	if err := l.loadXmlConfiguration([]byte("<logging")); err == nil || last().Op != "config" {
+		t.Errorf("configuration failure not reported: %+v", last())
+	}
+
+	// Writers which cannot be created fail the configuration
+	for _, c := range []struct{ typ, props, op string }{
+		{"file", `<property name="filename">/nonexistent/dir/test.log</property>`, "open"},
+		{"xml", `<property name="filename">/nonexistent/dir/test.xml</property>`, "open"},
+		{"socket", `<property name="protocol">unix</property><property name="endpoint">/nonexistent/dir/sock</property>`, "dial"},
+	} {
+		count := len(errs)
+		err := l.loadXmlConfiguration([]byte(`<logging><filter enabled="true"><tag>x</tag><type>` + c.typ +
+			`</type><level>INFO</level>` + c.props + `</filter></logging>`))
+		cause, _ := last().Err.(*WriterError)
+		if err == nil || len(errs) != count+1 || last().Op != "config" || cause == nil || cause.Op != c.op {
+			t.Errorf("%s writer failure not reported once: %v %+v", c.typ, err, last())
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	l := NewLogger()
+	file := NewFileLogWriter(testLogFile, false).SetFormat("%M").SetRotateLines(2)
+	defer os.Remove(testLogFile)
+	l.AddFilter("file", INFO, file)
+	l.GetLogger("payments").AddFilter("rec", FINEST, &recordingWriter{})
+
+	l.Info("one")
+	l.Warn("two")
+	l.Error("three")
+	l.Debug("not accepted")
+	l.GetLogger("payments").Debug("four")
+	l.Flush(time.Second)
+
+	stats := l.Stats()
+	if len(stats) != 2 || stats[0].Filter != "file" || stats[1].Logger != "payments" {
+		t.Fatalf("unexpected filters: %+v", stats)
+	}
+	if got, want := fmt.Sprint(stats[0].Accepted), "map[ERROR:1 INFO:1 WARNING:1]"; got != want {
+		t.Errorf("file accepted %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(stats[1].Accepted), "map[DEBUG:1]"; got != want || stats[1].Writer != nil {
+		t.Errorf("payments accepted %s, want %s without writer stats", got, want)
+	}
+	if ws := stats[0].Writer; ws == nil || ws.Bytes != 14 || ws.Rotations != 1 || ws.Dropped != 0 || ws.QueueDepth != 0 {
+		t.Errorf("file writer stats: %+v", ws)
+	}
+	l.Close()
+
+	var published []FilterStats
+	if err := json.Unmarshal([]byte(expvar.Get(ExpvarName).String()), &published); err != nil {
+		t.Errorf("expvar %s: %s", ExpvarName, err)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	const (
+		NOTICE = INFO + 5
+		ALERT  = CRITICAL + 10
+	)
+	if _, err := ParseLevel("NOTICE"); err != nil {
+		if err := RegisterLevel(NOTICE, "NOTICE", "NOTC"); err != nil {
+			t.Fatalf("RegisterLevel(NOTICE): %s", err)
+		}
+		if err := RegisterLevel(ALERT, "ALERT", "ALRT"); err != nil {
+			t.Fatalf("RegisterLevel(ALERT): %s", err)
+		}
+	}
+	for _, dup := range []struct {
+		lvl        Level
+		name, code string
+	}{{NOTICE, "NOTICE2", "NTC2"}, {NOTICE + 1, "notice", "NTC2"}, {NOTICE + 1, "NOTICE2", "info"}, {NOTICE + 1, "", ""}} {
+		if err := RegisterLevel(dup.lvl, dup.name, dup.code); err == nil {
+			t.Errorf("RegisterLevel(%d, %q, %q) succeeded", dup.lvl, dup.name, dup.code)
+		}
+	}
+
+	l := NewLogger()
+	rec := &recordingWriter{}
+	l.AddFilter("rec", NOTICE, rec)
+	l.Info("not written")
+	l.Logf(NOTICE, "notice %d", 1)
+	l.Critical("critical")
+	l.Log(ALERT, "src", "alert")
+	l.Close()
+
+	var got []string
+	for _, r := range rec.recs {
+		got = append(got, FormatLogRecord("[%L] %M", r))
+	}
+	if want := []string{"[NOTC] notice 1\n", "[CRIT] critical\n", "[ALRT] alert\n"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if lvls := fmt.Sprint(Levels()); lvls != "[FNST FINE DEBG TRAC INFO NOTC WARN EROR CRIT ALRT]" {
+		t.Errorf("Levels() = %s", lvls)
+	}
+
+	for s, want := range map[string]Level{"notice": NOTICE, "NOTC": NOTICE, " Warning": WARNING, "eror": ERROR, "45": NOTICE, "8": 8, "3": 3, "7": 7, "0": FINEST} {
+		if lvl, err := ParseLevel(s); err != nil || lvl != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", s, lvl, err, want)
+		}
+	}
+	if _, err := ParseLevel("LOUD"); err == nil {
+		t.Errorf("ParseLevel(LOUD) succeeded")
+	}
+
+	js, err := json.Marshal(&LogRecord{Level: NOTICE})
+	if err != nil || !strings.Contains(string(js), `"Level":"NOTICE"`) {
+		t.Errorf("json.Marshal: %s, %v", js, err)
+	}
+	var levels struct{ A, B, C, D Level }
+	if err := json.Unmarshal([]byte(`{"A":"alert","B":"DEBG","C":50,"D":6}`), &levels); err != nil ||
+		levels.A != ALERT || levels.B != DEBUG || levels.C != WARNING || levels.D != ERROR {
+		t.Errorf("json.Unmarshal: %+v, %v", levels, err)
+	}
+	if err := json.Unmarshal([]byte(`{"A":"LOUD"}`), &levels); err == nil {
+		t.Errorf("json.Unmarshal of an unknown level succeeded")
+	}
+	for _, want := range []Level{3, NOTICE, 8, -1} {
+		var lvl Level
+		if js, err := json.Marshal(want); err != nil || json.Unmarshal(js, &lvl) != nil || lvl != want {
+			t.Errorf("json round trip of %d: %s read as %d", want, js, lvl)
+		}
+	}
+	if err := yaml.Unmarshal([]byte("a: notice\nb: CRIT\nc: 4\n"), &levels); err != nil || levels.A != NOTICE || levels.B != CRITICAL || levels.C != 4 {
+		t.Errorf("yaml.Unmarshal: %+v, %v", levels, err)
+	}
+
+	lvl := INFO
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&lvl, "level", "logging level")
+	if err := fs.Parse([]string{"-level=notice"}); err != nil || lvl != NOTICE || fs.Lookup("level").DefValue != "INFO" {
+		t.Errorf("flag: %v, %v", lvl, err)
+	}
+	if err := fs.Parse([]string{"-level=loud"}); err == nil {
+		t.Errorf("flag accepted an unknown level")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	l := NewLogger()
+	rec := &recordingWriter{}
+	l.AddFilter("rec", DEBUG, rec)
+
+	var order []string
+	l.AddHook("host", 10, func(r *LogRecord) bool {
+		order = append(order, "host")
+		r.AddFields("host", "h1")
+		return true
+	})
+	l.AddHook("veto", 20, func(r *LogRecord) bool {
+		order = append(order, "veto")
+		return !strings.HasPrefix(r.Message, "noisy")
+	})
+	l.AddHook("rewrite", 0, func(r *LogRecord) bool {
+		order = append(order, "rewrite")
+		r.Message = strings.Replace(r.Message, "secret", "***", -1)
+		return true
+	})
+	gateway := l.GetLogger("payments.gateway").AddHook("pod", 0, func(r *LogRecord) bool {
+		order = append(order, "pod")
+		r.AddFields("pod", "p1")
+		return true
+	})
+	if got := fmt.Sprint(l.Hooks()); got != "[rewrite host veto]" {
+		t.Errorf("Hooks() = %s", got)
+	}
+
+	reqLog := l.With("request", "r1")
+	reqLog.Info("password is secret")
+	if got := fmt.Sprint(order); got != "[rewrite host veto]" {
+		t.Errorf("hooks ran in order %s", got)
+	}
+	l.Info("noisy library message")
+	gateway.Log(WARNING, "src", "paid")
+	if got := reqLog.Fields().String(); got != "request=r1" {
+		t.Errorf("a hook modified the logger fields: %q", got)
+	}
+
+	order = nil
+	l.AddHook("host", 30, func(r *LogRecord) bool {
+		order = append(order, "host2")
+		return true
+	})
+	if !l.RemoveHook("veto") || l.RemoveHook("veto") {
+		t.Errorf("RemoveHook(veto) did not remove it once")
+	}
+	l.Info("noisy again")
+	if got := fmt.Sprint(order); got != "[rewrite host2]" {
+		t.Errorf("hooks ran in order %s after changes", got)
+	}
+	l.Close()
+
+	var got []string
+	for _, r := range rec.recs {
+		got = append(got, FormatLogRecord("%M%F", r))
+	}
+	want := []string{"password is *** request=r1 host=h1\n", "paid host=h1 pod=p1\n", "noisy again\n"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	l := NewLogger()
+	l.AddFilter("file", ERROR, NewFileLogWriter(testLogFile, false).SetFormat("[%L] (%S) %M%K"))
+	defer os.Remove(testLogFile)
+	rec := &recordingWriter{}
+	l.GetLogger("jobs").AddFilter("rec", INFO, rec)
+
+	func() {
+		defer Recover(l.GetLogger("jobs"), RECOVER_CONTINUE)
+		var m map[string]int
+		m["a"] = 1
+	}()
+
+	// The file writer has been flushed
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil || !strings.HasPrefix(string(contents), "[CRIT] (github.com/gojuno/log4go.TestRecover.func1:") ||
+		!strings.Contains(string(contents), "panic: assignment to entry in nil map\ngithub.com/gojuno/log4go.TestRecover.func1\n") {
+		t.Errorf("file: %q, %v", contents, err)
+	}
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("recovered %v, want the panic to go on", v)
+			}
+		}()
+		defer Recover(l)
+		panic("boom")
+	}()
+
+	done := make(chan bool)
+	Go(l.GetLogger("jobs"), func() {
+		defer close(done)
+		panic(fmt.Errorf("in goroutine"))
+	}, RECOVER_CONTINUE)
+	<-done
+	l.Close()
+
+	if len(rec.recs) != 2 || rec.recs[1].Message != "panic: in goroutine" || rec.recs[1].Logger != "jobs" ||
+		!strings.Contains(rec.recs[1].Source, ".TestRecover.func") {
+		t.Errorf("records: %v", rec.recs)
+	}
+}
+
+type stuckCloser struct {
+	recordingWriter
+	release chan bool
+}
+
+func (w *stuckCloser) Close() {
+	<-w.release
+	w.recordingWriter.Close()
+}
+
+func TestTerminationPolicy(t *testing.T) {
+	var exits []int
+	var panics []interface{}
+	policy := DefaultTerminationPolicy
+	policy.Exit = func(code int) { exits = append(exits, code) }
+	policy.Panic = func(v interface{}) { panics = append(panics, v) }
+	policy.ExitCode = 3
+	SetTerminationPolicy(&policy)
+	defer SetTerminationPolicy(nil)
+
+	rec := &recordingWriter{}
+	Global.AddFilter("rec", FINEST, rec)
+	Fatal("fatal %d", 1)
+	if !rec.closed || len(rec.recs) != 1 || rec.recs[0].Level != CRITICAL {
+		t.Errorf("Fatal did not log and close the writers: %v", rec.recs)
+	}
+
+	rec = &recordingWriter{}
+	Global.AddFilter("rec", FINEST, rec)
+	Exitf("exit %d", 2)
+	Global.AddFilter("rec", FINEST, rec)
+	Crash("crash")
+	Global.AddFilter("rec", FINEST, rec)
+	Crashf("crash %d", 4)
+	if got := fmt.Sprint(exits, panics); got != "[3 0] [crash crash 4]" {
+		t.Errorf("exits and panics: %s", got)
+	}
+	if len(rec.recs) != 3 || rec.recs[1].Stack == "" || rec.recs[2].Message != "crash 4" {
+		t.Errorf("records: %v", rec.recs)
+	}
+
+	// The formatting wrappers pass their arguments on, and the records are
+	// attributed to their callers
+	rec = &recordingWriter{}
+	Global.AddFilter("rec", FINEST, rec)
+	Fatalf("fatal %d", 5)
+	Global.AddFilter("rec", FINEST, rec)
+	Fatalln("fatal", 6)
+	Global.AddFilter("rec", FINEST, rec)
+	Critical("critical %d", 7)
+	Global.Close()
+	var got []string
+	for _, r := range rec.recs {
+		if !strings.Contains(r.Source, ".TestTerminationPolicy:") {
+			t.Errorf("%q logged from %s", r.Message, r.Source)
+		}
+		got = append(got, r.Message)
+	}
+	if fmt.Sprint(got) != "[fatal 5 fatal 6 critical 7]" {
+		t.Errorf("messages: %q", got)
+	}
+
+	// Configuration errors are reported once, then end the program
+	exits = nil
+	var errs []string
+	Global.SetErrorHandler(func(err *WriterError) { errs = append(errs, err.Op) })
+	defer Global.SetErrorHandler(nil)
+	ioutil.WriteFile("_invalid.xml", []byte("<logging><filter"), 0644)
+	defer os.Remove("_invalid.xml")
+	Global.LoadConfiguration("_does_not_exist.xml")
+	Global.LoadConfiguration("log4go_test.go")
+	Global.LoadConfiguration("_invalid.xml")
+	ioutil.WriteFile("_unopened.xml", []byte(`<logging><filter enabled="true"><tag>file</tag><type>file</type>`+
+		`<level>INFO</level><property name="filename">/nonexistent/dir/test.log</property></filter></logging>`), 0644)
+	defer os.Remove("_unopened.xml")
+	Global.LoadConfiguration("_unopened.xml")
+	if got := fmt.Sprint(exits, errs); got != "[3 3 3 3] [config config config config]" {
+		t.Errorf("configuration errors exits and reports: %s", got)
+	}
+
+	// The writers are waited for up to the FlushTimeout
+	exits = nil
+	l := NewLogger()
+	named := l.GetLogger("stuck")
+	policy.FlushTimeout = 10 * time.Millisecond
+	l.SetTerminationPolicy(&policy)
+	stuck := &stuckCloser{release: make(chan bool)}
+	named.AddFilter("stuck", FINEST, stuck)
+	named.exit(5)
+	if got := fmt.Sprint(exits); got != "[5]" || named.TerminationPolicy().FlushTimeout != policy.FlushTimeout {
+		t.Errorf("exits: %s", got)
+	}
+	close(stuck.release)
+
+	// Recover re-panics through the policy
+	func() {
+		defer Recover(named)
+		panic("recovered")
+	}()
+	if len(panics) != 3 || panics[2] != "recovered" {
+		t.Errorf("panics: %v", panics)
+	}
+	if p := NewLogger().TerminationPolicy(); p.Exit != nil || p.ExitCode != 1 {
+		t.Errorf("default policy: %+v", p)
+	}
+}
+
+func TestStdLog(t *testing.T) {
+	l := NewLogger()
+	rec := &recordingWriter{}
+	l.AddFilter("rec", DEBUG, rec)
+	l.SetStackLevel("rec", ERROR)
+
+	std := NewStdLogger(l, INFO)
+	std.Printf("hello %d", 1)
+	std.Print("[WARN] careful")
+	std.Println("error: closed")
+	std.Print("host:80: refused")
+	std.Print("[LOUD] unknown level")
+	stdlog.New(NewStdLogWriter(l, DEBUG), "", stdlog.LstdFlags|stdlog.Lmicroseconds|stdlog.Lshortfile).Print("with header")
+
+	out := stdlog.Writer()
+	restore := RedirectStdLog(l.GetLogger("deps"), INFO)
+	stdlog.Print("global")
+	restore()
+	if stdlog.Writer() != out {
+		t.Errorf("RedirectStdLog did not restore the output")
+	}
+	l.Close()
+
+	want := []string{
+		"INFO hello 1", "WARN careful", "EROR closed", "INFO host:80: refused",
+		"INFO [LOUD] unknown level", "DEBG with header", "INFO global deps",
+	}
+	if len(rec.recs) != len(want) {
+		t.Fatalf("got %d records, want %d", len(rec.recs), len(want))
+	}
+	for i, r := range rec.recs {
+		if got := strings.TrimSpace(fmt.Sprintf("%s %s %s", r.Level, r.Message, r.Logger)); got != want[i] {
+			t.Errorf("record %d: got %q, want %q", i, got, want[i])
+		}
+		if !strings.Contains(r.Source, ".TestStdLog:") {
+			t.Errorf("record %d: source %q is not the caller of log", i, r.Source)
+		}
+		if hasStack := strings.HasPrefix(r.Stack, "github.com/gojuno/log4go.TestStdLog\n"); hasStack != (r.Level >= ERROR) {
+			t.Errorf("record %d: stack trace %q", i, r.Stack)
+		}
+	}
+}
+
+func TestNamedLoggers(t *testing.T) {
+	root := NewLogger()
+	rootRecs := &recordingWriter{}
+	root.AddFilter("root", INFO, rootRecs)
+
+	gateway := root.GetLogger("payments.gateway")
+	payments := root.GetLogger("payments")
+	if gateway.Parent() != payments || payments.Parent() != root || gateway.GetLogger("") != root {
+		t.Fatalf("GetLogger built an invalid hierarchy")
+	}
+	if root.GetLogger("payments.gateway") != gateway {
+		t.Fatalf("GetLogger returned a new logger for an existing name")
+	}
+	gwRecs := &recordingWriter{}
+	gateway.AddFilter("gw", FINEST, gwRecs)
+
+	payments.SetCategoryLevel(DEBUG)
+	gateway.Fine("dropped by the payments category level")
+	gateway.Debug("gateway debug")
+	gateway.Info("gateway info")
+	payments.Info("payments info")
+
+	gateway.SetAdditivity(false)
+	gateway.Info("gateway only")
+
+	if lvl, ok := gateway.EffectiveLevel(); !ok || lvl != DEBUG {
+		t.Errorf("EffectiveLevel = %v, %v; want %v, true", lvl, ok, DEBUG)
+	}
+
+	var got []string
+	for _, rec := range gwRecs.recs {
+		got = append(got, FormatLogRecord("%C %L %M", rec))
+	}
+	for _, rec := range rootRecs.recs {
+		got = append(got, FormatLogRecord("root: %C %L %M", rec))
+	}
+	want := []string{
+		"payments.gateway DEBG gateway debug\n",
+		"payments.gateway INFO gateway info\n",
+		"payments.gateway INFO gateway only\n",
+		"root: payments.gateway INFO gateway info\n",
+		"root: payments INFO payments info\n",
+	}
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("got  %q", got)
+		t.Errorf("want %q", want)
+	}
+
+	root.Close()
+	if !gwRecs.closed || gateway.Additivity() == false {
+		t.Errorf("Close on the root did not close and reset the named loggers")
+	}
+}
+
+func TestCategoryConfig(t *testing.T) {
+	defer func(root string) {
+		YamlCategoriesRoot = root
+	}(YamlCategoriesRoot)
+	YamlCategoriesRoot = "app.categories"
+
+	yamlConfig := []byte(`
+logging:
+  gw:
+    enabled: true
+    type: console
+    level: FINEST
+    category: payments.gateway
+app:
+  categories:
+    payments:
+      level: WARNING
+    payments.gateway:
+      additivity: false
+`)
+	xmlConfig := []byte(`<logging>
+  <filter enabled="true">
+    <tag>gw</tag>
+    <type>console</type>
+    <level>FINEST</level>
+    <category>payments.gateway</category>
+  </filter>
+  <category name="payments"><level>WARNING</level></category>
+  <category name="payments.gateway" additivity="false"/>
+</logging>`)
+
+	for _, test := range []struct {
+		Name string
+		Load func(*Logger) error
+	}{
+		{"yaml", func(l *Logger) error { return l.loadYamlConfiguration(yamlConfig) }},
+		{"xml", func(l *Logger) error { return l.loadXmlConfiguration(xmlConfig) }},
+	} {
+		l := NewLogger()
+		if err := test.Load(l); err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+		gateway := l.GetLogger("payments.gateway")
+		if _, ok := gateway.Filters()["gw"]; !ok || len(l.Filters()) != 0 {
+			t.Errorf("%s: filter not attached to its category", test.Name)
+		}
+		if lvl, ok := l.GetLogger("payments").CategoryLevel(); !ok || lvl != WARNING {
+			t.Errorf("%s: payments level = %v, %v", test.Name, lvl, ok)
+		}
+		if _, ok := gateway.CategoryLevel(); ok || gateway.Additivity() {
+			t.Errorf("%s: payments.gateway not configured as expected", test.Name)
+		}
+		l.Close()
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	l := NewLogger()
+	l.AddFilter("rec", INFO, &recordingWriter{})
+	l.GetLogger("payments").AddFilter("pay", ERROR, &recordingWriter{})
+	h := NewAdminHandler(l)
+
+	serve := func(method, target string) (int, string) {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+		return rw.Code, rw.Body.String()
+	}
+
+	code, body := serve("GET", "/")
+	want := `[{"logger":"","filter":"rec","level":"INFO","writer":"*log4go.recordingWriter"},` +
+		`{"logger":"payments","filter":"pay","level":"ERROR","writer":"*log4go.recordingWriter"}]` + "\n"
+	if code != 200 || body != want {
+		t.Errorf("GET: %d %s", code, body)
+	}
+
+	if code, body = serve("PUT", "/?logger=payments&filter=pay&level=debug"); code != 200 {
+		t.Errorf("PUT: %d %s", code, body)
+	}
+	if lvl := l.GetLogger("payments").Filters()["pay"].Level; lvl != DEBUG {
+		t.Errorf("PUT did not change the level: %v", lvl)
+	}
+	if code, body = serve("GET", "/?filter=rec&level=FINEST&revert=20ms"); code != 200 {
+		t.Errorf("GET change: %d %s", code, body)
+	}
+	if lvl := l.Filters()["rec"].Level; lvl != FINEST {
+		t.Errorf("GET did not change the level: %v", lvl)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if lvl := l.Filters()["rec"].Level; lvl != INFO {
+		t.Errorf("level was not reverted: %v", lvl)
+	}
+
+	for _, target := range []string{"/?filter=nope&level=INFO", "/?logger=nope&filter=rec&level=INFO"} {
+		if code, _ = serve("PUT", target); code != 404 {
+			t.Errorf("PUT %s: got status %d, want 404", target, code)
+		}
+	}
+	if code, _ = serve("PUT", "/?filter=rec&level=LOUD"); code != 400 {
+		t.Errorf("PUT with invalid level: got status %d, want 400", code)
+	}
+	if !l.SetLevel("rec", WARNING) || l.SetLevel("nope", WARNING) {
+		t.Errorf("SetLevel reported the wrong result")
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	l := NewLogger()
+	w := &recordingWriter{}
+	l.AddFilter("rec", FINEST, w)
+	if got := l.Filters()["rec"].StackLevel; got != STACK_NONE {
+		t.Errorf("default stack level %s", got)
+	}
+	l.SetStackLevel("rec", ERROR)
+
+	l.Info("no stack")
+	l.Error("stack")
+	l.SetStackLevel("rec", STACK_NONE)
+	l.Critical("no stack either")
+	l.SetStackLevel("rec", DEBUG)
+	l.Log(DEBUG, "src", "manual")
+
+	if len(w.recs) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(w.recs))
+	}
+	if w.recs[0].Stack != "" || w.recs[2].Stack != "" {
+		t.Errorf("unexpected stack trace: %q", w.recs[0].Stack+w.recs[2].Stack)
+	}
+	for _, rec := range []*LogRecord{w.recs[1], w.recs[3]} {
+		if want := "github.com/gojuno/log4go.TestStackTrace\n\t"; !strings.HasPrefix(rec.Stack, want) {
+			t.Errorf("stack trace does not start at the caller: %q", rec.Stack)
+		}
+	}
+
+	rec := &LogRecord{Level: ERROR, Message: "m", Stack: "main.f\n\tf.go:1"}
+	if got, want := FormatLogRecord("%M%K", rec), "m\nmain.f\n\tf.go:1\n"; got != want {
+		t.Errorf("%%K: got %q want %q", got, want)
+	}
+	if got, want := FormatLogRecord("%X", rec), "<stack>main.f&#xA;&#x9;f.go:1</stack>\n"; got != want {
+		t.Errorf("%%X: got %q want %q", got, want)
+	}
+	if js, _ := json.Marshal(rec); !strings.Contains(string(js), `"Stack":"main.f\n\tf.go:1"`) {
+		t.Errorf("json: %s", js)
+	}
+}
+
 func TestLogOutput(t *testing.T) {
+	// The messages hold the level numbers, which changed from 0..7 to 0..70
+	// with the level registry; TestLevel checks the old numbers are still read
 	const (
-		expected = "fdf3e51e444da56b4cb400f30bc47424"
+		expected = "d88880cb887863f4469e88dbbd7d5583"
 	)
 
 	// Unbuffered output
@@ -233,7 +1697,7 @@ func TestLogOutput(t *testing.T) {
 	}(LogBufferLength)
 	LogBufferLength = 0
 
-	l := make(Logger)
+	l := NewLogger()
 
 	// Delete and open the output log without a timestamp (for a constant md5sum)
 	l.AddFilter("file", FINEST, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %M"))
@@ -265,47 +1729,103 @@ func TestLogOutput(t *testing.T) {
 	}
 }
 
-func TestCountMallocs(t *testing.T) {
-	const N = 1
-	var m runtime.MemStats
-	getMallocs := func() uint64 {
-		runtime.ReadMemStats(&m)
-		return m.Mallocs
-	}
+// A LogWriter keeping the messages of the records, which it releases
+type releasingWriter struct {
+	msgs []string
+}
 
-	// Console logger
-	sl := NewDefaultLogger(INFO)
-	mallocs := 0 - getMallocs()
-	for i := 0; i < N; i++ {
-		sl.Log(WARNING, "here", "This is a WARNING message")
+func (w *releasingWriter) LogWrite(rec *LogRecord) {
+	w.msgs = append(w.msgs, FormatLogRecord("%L %S %M", rec))
+	rec.Release()
+}
+
+func (w *releasingWriter) Close() {
+}
+
+func TestRecordPool(t *testing.T) {
+	kept, released, ringed, deduped := &recordingWriter{}, &releasingWriter{}, &recordingWriter{}, &releasingWriter{}
+	l := NewLogger()
+	l.AddFilter("kept", WARNING, kept)
+	l.AddFilter("released", FINEST, released)
+	l.AddFilter("ring", FINEST, NewRingLogWriter(ringed, 2, CRITICAL))
+	l.AddFilter("dedup", ERROR, NewDedupLogWriter(deduped, time.Hour))
+	for i := 0; i < 10; i++ {
+		l.Info("info %d", i)
+		l.Warn("warning %d", i)
+		l.Log(ERROR, "src", "repeated")
 	}
-	mallocs += getMallocs()
-	fmt.Printf("mallocs per sl.Log((WARNING, \"here\", \"This is a log message\"): %d\n", mallocs/N)
+	l.Critical("critical")
+	l.Close()
 
-	// Console logger formatted
-	mallocs = 0 - getMallocs()
-	for i := 0; i < N; i++ {
-		sl.Logf(WARNING, "%s is a log message with level %d", "This", WARNING)
+	// The records kept by the writers are not reused for other messages
+	msgs := func(recs []*LogRecord) (msgs []string) {
+		for _, rec := range recs {
+			msgs = append(msgs, rec.Message)
+		}
+		return msgs
+	}
+	if got := msgs(kept.recs); len(got) != 21 || got[0] != "warning 0" || got[1] != "repeated" || got[18] != "warning 9" || got[20] != "critical" {
+		t.Errorf("kept records: %q", got)
+	}
+	if got := fmt.Sprint(msgs(ringed.recs)); got != "[warning 9 repeated critical]" {
+		t.Errorf("ring records: %s", got)
+	}
+	if got := fmt.Sprint(deduped.msgs); got != "[EROR src repeated\n EROR src last message repeated 9 times\n CRIT "+kept.recs[20].Source+" critical\n]" {
+		t.Errorf("dedup records: %s", got)
+	}
+	if len(released.msgs) != 31 || released.msgs[30] != deduped.msgs[2] {
+		t.Errorf("released records: %q", released.msgs)
 	}
-	mallocs += getMallocs()
-	fmt.Printf("mallocs per sl.Logf(WARNING, \"%%s is a log message with level %%d\", \"This\", WARNING): %d\n", mallocs/N)
 
-	// Console logger (not logged)
-	sl = NewDefaultLogger(INFO)
-	mallocs = 0 - getMallocs()
-	for i := 0; i < N; i++ {
-		sl.Log(DEBUG, "here", "This is a DEBUG log message")
+	// A record goes back to the pool once every reference is released
+	rec := getLogRecord(LogRecord{Message: "pooled"})
+	rec.Retain()
+	rec.Release()
+	if rec.Message != "pooled" {
+		t.Errorf("record reset while retained")
+	}
+	rec.Release()
+	if rec.Message != "" {
+		t.Errorf("record not reset once released")
+	}
+	rec = &LogRecord{Message: "built"}
+	rec.Release()
+	if rec.Message != "built" {
+		t.Errorf("record not built by a Logger reset")
 	}
-	mallocs += getMallocs()
-	fmt.Printf("mallocs per unlogged sl.Log((WARNING, \"here\", \"This is a log message\"): %d\n", mallocs/N)
+}
+
+func TestCountMallocs(t *testing.T) {
+	// Unbuffered writers, so the records are written within the runs
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
 
-	// Console logger formatted (not logged)
-	mallocs = 0 - getMallocs()
-	for i := 0; i < N; i++ {
-		sl.Logf(DEBUG, "%s is a log message with level %d", "This", DEBUG)
+	// Records and buffers are reused once written, only formatting the
+	// message and returning it as an error allocate (the race detector
+	// makes the pools drop some of them)
+	sl := NewLogger().AddFilter("discard", INFO, NewFormatLogWriter(ioutil.Discard, FORMAT_DEFAULT))
+	defer sl.Close()
+	abbrev := NewLogger().AddFilter("discard", INFO, NewFormatLogWriter(ioutil.Discard, FORMAT_ABBREV))
+	defer abbrev.Close()
+	for _, test := range []struct {
+		name string
+		max  float64
+		log  func()
+	}{
+		{"Log", 1, func() { sl.Log(WARNING, "here", "This is a log message") }},
+		{"Info", 1, func() { sl.Info("This is a log message") }},
+		{"Info formatted", 3, func() { sl.Info("%s is a log message", "This") }},
+		{"Warn", 2, func() { sl.Warn("This is a log message") }},
+		{"Logf without source", 3, func() { abbrev.Logf(WARNING, "%s is a log message with level %d", "This", WARNING) }},
+		{"unlogged Log", 0, func() { sl.Log(DEBUG, "here", "This is a DEBUG log message") }},
+		{"unlogged Logf", 0, func() { sl.Logf(DEBUG, "%s is a log message with level %d", "This", DEBUG) }},
+	} {
+		if got := testing.AllocsPerRun(1000, test.log); got > test.max {
+			t.Errorf("%s: %v mallocs per record, want at most %v", test.name, got, test.max)
+		}
 	}
-	mallocs += getMallocs()
-	fmt.Printf("mallocs per unlogged sl.Logf(WARNING, \"%%s is a log message with level %%d\", \"This\", WARNING): %d\n", mallocs/N)
 }
 
 func TestXMLConfig(t *testing.T) {
@@ -331,17 +1851,17 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "    <level>FINEST</level>")
 	fmt.Fprintln(fd, "    <property name=\"filename\">test.log</property>")
 	fmt.Fprintln(fd, "    <!--")
-	fmt.Fprintln(fd, "       %T - Time (15:04:05 MST)")
-	fmt.Fprintln(fd, "       %t - Time (15:04)")
-	fmt.Fprintln(fd, "       %D - Date (2006/01/02)")
-	fmt.Fprintln(fd, "       %d - Date (01/02/06)")
-	fmt.Fprintln(fd, "       %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)")
-	fmt.Fprintln(fd, "       %S - Source")
-	fmt.Fprintln(fd, "       %M - Message")
+	fmt.Fprintf(fd, "       %%T - Time (15:04:05 MST)\n")
+	fmt.Fprintf(fd, "       %%t - Time (15:04)\n")
+	fmt.Fprintf(fd, "       %%D - Date (2006/01/02)\n")
+	fmt.Fprintf(fd, "       %%d - Date (01/02/06)\n")
+	fmt.Fprintf(fd, "       %%L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)\n")
+	fmt.Fprintf(fd, "       %%S - Source\n")
+	fmt.Fprintf(fd, "       %%M - Message\n")
 	fmt.Fprintln(fd, "       It ignores unknown format strings (and removes them)")
-	fmt.Fprintln(fd, "       Recommended: \"[%D %T] [%L] (%S) %M\"")
+	fmt.Fprintf(fd, "       Recommended: \"[%%D %%T] [%%L] (%%S) %%M\"\n")
 	fmt.Fprintln(fd, "    -->")
-	fmt.Fprintln(fd, "    <property name=\"format\">[%D %T] [%L] (%S) %M</property>")
+	fmt.Fprintf(fd, "    <property name=\"format\">[%%D %%T] [%%L] (%%S) %%M</property>\n")
 	fmt.Fprintln(fd, "    <property name=\"rotate\">false</property> <!-- true enables log rotation, otherwise append -->")
 	fmt.Fprintln(fd, "    <property name=\"maxsize\">0M</property> <!-- \\d+[KMG]? Suffixes are in terms of 2**10 -->")
 	fmt.Fprintln(fd, "    <property name=\"maxlines\">0K</property> <!-- \\d+[KMG]? Suffixes are in terms of thousands -->")
@@ -367,62 +1887,63 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "</logging>")
 	fd.Close()
 
-	log := make(Logger)
+	log := NewLogger()
 	log.LoadConfiguration(configfile)
 	defer os.Remove("trace.xml")
 	defer os.Remove("test.log")
 	defer log.Close()
+	filters := log.Filters()
 
 	// Make sure we got all loggers
-	if len(log) != 3 {
-		t.Fatalf("XMLConfig: Expected 3 filters, found %d", len(log))
+	if len(filters) != 3 {
+		t.Fatalf("XMLConfig: Expected 3 filters, found %d", len(filters))
 	}
 
 	// Make sure they're the right keys
-	if _, ok := log["stdout"]; !ok {
+	if _, ok := filters["stdout"]; !ok {
 		t.Errorf("XMLConfig: Expected stdout logger")
 	}
-	if _, ok := log["file"]; !ok {
+	if _, ok := filters["file"]; !ok {
 		t.Fatalf("XMLConfig: Expected file logger")
 	}
-	if _, ok := log["xmllog"]; !ok {
+	if _, ok := filters["xmllog"]; !ok {
 		t.Fatalf("XMLConfig: Expected xmllog logger")
 	}
 
 	// Make sure they're the right type
-	if _, ok := log["stdout"].LogWriter.(ConsoleLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected stdout to be ConsoleLogWriter, found %T", log["stdout"].LogWriter)
+	if _, ok := filters["stdout"].LogWriter.(*ConsoleLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected stdout to be ConsoleLogWriter, found %T", filters["stdout"].LogWriter)
 	}
-	if _, ok := log["file"].LogWriter.(*FileLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected file to be *FileLogWriter, found %T", log["file"].LogWriter)
+	if _, ok := filters["file"].LogWriter.(*FileLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected file to be *FileLogWriter, found %T", filters["file"].LogWriter)
 	}
-	if _, ok := log["xmllog"].LogWriter.(*FileLogWriter); !ok {
-		t.Fatalf("XMLConfig: Expected xmllog to be *FileLogWriter, found %T", log["xmllog"].LogWriter)
+	if _, ok := filters["xmllog"].LogWriter.(*FileLogWriter); !ok {
+		t.Fatalf("XMLConfig: Expected xmllog to be *FileLogWriter, found %T", filters["xmllog"].LogWriter)
 	}
 
 	// Make sure levels are set
-	if lvl := log["stdout"].Level; lvl != DEBUG {
+	if lvl := filters["stdout"].Level; lvl != DEBUG {
 		t.Errorf("XMLConfig: Expected stdout to be set to level %d, found %d", DEBUG, lvl)
 	}
-	if lvl := log["file"].Level; lvl != FINEST {
+	if lvl := filters["file"].Level; lvl != FINEST {
 		t.Errorf("XMLConfig: Expected file to be set to level %d, found %d", FINEST, lvl)
 	}
-	if lvl := log["xmllog"].Level; lvl != TRACE {
+	if lvl := filters["xmllog"].Level; lvl != TRACE {
 		t.Errorf("XMLConfig: Expected xmllog to be set to level %d, found %d", TRACE, lvl)
 	}
 
 	// Make sure the w is open and points to the right file
-	if fname := log["file"].LogWriter.(*FileLogWriter).file.Name(); fname != "test.log" {
+	if fname := filters["file"].LogWriter.(*FileLogWriter).file.Name(); fname != "test.log" {
 		t.Errorf("XMLConfig: Expected file to have opened %s, found %s", "test.log", fname)
 	}
 
 	// Make sure the XLW is open and points to the right file
-	if fname := log["xmllog"].LogWriter.(*FileLogWriter).file.Name(); fname != "trace.xml" {
+	if fname := filters["xmllog"].LogWriter.(*FileLogWriter).file.Name(); fname != "trace.xml" {
 		t.Errorf("XMLConfig: Expected xmllog to have opened %s, found %s", "trace.xml", fname)
 	}
 
-	// Move XML log file
-	os.Rename(configfile, "examples/"+configfile) // Keep this so that an example with the documentation is available
+	// Remove XML log file, examples/example.xml documents the configuration
+	os.Remove(configfile)
 }
 
 func BenchmarkFormatLogRecord(b *testing.B) {
@@ -475,6 +1996,15 @@ func BenchmarkConsoleUtilLog(b *testing.B) {
 	}
 }
 
+func BenchmarkConsoleUtilLogAbbrev(b *testing.B) {
+	w := NewConsoleLogWriter()
+	w.SetFormat(FORMAT_ABBREV)
+	sl := NewLogger().AddFilter("stdout", INFO, w)
+	for i := 0; i < b.N; i++ {
+		sl.Info("%s is a log message", "This")
+	}
+}
+
 func BenchmarkConsoleUtilNotLog(b *testing.B) {
 	sl := NewDefaultLogger(INFO)
 	for i := 0; i < b.N; i++ {
@@ -483,7 +2013,7 @@ func BenchmarkConsoleUtilNotLog(b *testing.B) {
 }
 
 func BenchmarkFileLog(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
 	b.StartTimer()
@@ -495,7 +2025,7 @@ func BenchmarkFileLog(b *testing.B) {
 }
 
 func BenchmarkFileNotLogged(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
 	b.StartTimer()
@@ -507,7 +2037,7 @@ func BenchmarkFileNotLogged(b *testing.B) {
 }
 
 func BenchmarkFileUtilLog(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
 	b.StartTimer()
@@ -519,7 +2049,7 @@ func BenchmarkFileUtilLog(b *testing.B) {
 }
 
 func BenchmarkFileUtilNotLog(b *testing.B) {
-	sl := make(Logger)
+	sl := NewLogger()
 	b.StopTimer()
 	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
 	b.StartTimer()
@@ -0,0 +1,215 @@
+/* log4gotest.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+
+// Package log4gotest helps testing code which logs with log4go: a Recorder
+// captures the records of a Logger, and its methods assert on them.
+//
+//   func TestCharge(t *testing.T) {
+//   	rec := log4gotest.InstallGlobal(t, log4go.DEBUG)
+//   	charge(42)
+//   	rec.AssertLogged(t, log4go.WARNING, `^retrying charge 42`)
+//   	rec.AssertNoErrors(t)
+//   }
+package log4gotest
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gojuno/log4go"
+)
+
+// DefaultTimeout is how long Flush and WaitFor wait.
+var DefaultTimeout = 5 * time.Second
+
+// A Recorder is a LogWriter keeping the records written to it.  It is safe
+// for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	recs    []*log4go.LogRecord
+	errs    []*log4go.WriterError
+	changed chan struct{} // closed and replaced when a record is written
+	resets  int           // number of Resets, which restart the scans of WaitFor
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{changed: make(chan struct{})}
+}
+
+// Number of the installed Recorders, naming their filters
+var installed uint64
+
+// Install adds a Recorder accepting the records at or above lvl to logger,
+// as a filter named "log4gotest-N", and removes it when the test ends.
+func Install(t testing.TB, logger *log4go.Logger, lvl log4go.Level) *Recorder {
+	t.Helper()
+	r := NewRecorder()
+	name := fmt.Sprintf("log4gotest-%d", atomic.AddUint64(&installed, 1))
+	logger.AddFilter(name, lvl, r)
+	t.Cleanup(func() { logger.RemoveFilter(name) })
+	return r
+}
+
+// InstallGlobal adds a Recorder to log4go.Global, see Install.
+func InstallGlobal(t testing.TB, lvl log4go.Level) *Recorder {
+	t.Helper()
+	return Install(t, log4go.Global, lvl)
+}
+
+// This is the Recorder's output method.
+func (r *Recorder) LogWrite(rec *log4go.LogRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs = append(r.recs, rec)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Close does nothing, the records are kept.
+func (r *Recorder) Close() {
+}
+
+// HandleError is an ErrorHandler keeping the writer errors, e.g.
+// logger.SetErrorHandler(rec.HandleError).
+func (r *Recorder) HandleError(err *log4go.WriterError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+// Records returns the records written so far.
+func (r *Recorder) Records() []*log4go.LogRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*log4go.LogRecord(nil), r.recs...)
+}
+
+// Messages returns the messages of the records written so far.
+func (r *Recorder) Messages() []string {
+	recs := r.Records()
+	msgs := make([]string, len(recs))
+	for i, rec := range recs {
+		msgs[i] = rec.Message
+	}
+	return msgs
+}
+
+// WriterErrors returns the errors passed to HandleError so far.
+func (r *Recorder) WriterErrors() []*log4go.WriterError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*log4go.WriterError(nil), r.errs...)
+}
+
+// Reset forgets the records and errors.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs, r.errs = nil, nil
+	r.resets++
+}
+
+// Find returns the first record at lvl whose message matches the regular
+// expression pattern, or nil.
+func (r *Recorder) Find(lvl log4go.Level, pattern string) *log4go.LogRecord {
+	re := regexp.MustCompile(pattern)
+	for _, rec := range r.Records() {
+		if rec.Level == lvl && re.MatchString(rec.Message) {
+			return rec
+		}
+	}
+	return nil
+}
+
+// AssertLogged fails the test unless a record at lvl whose message matches
+// pattern has been written, and returns it.
+func (r *Recorder) AssertLogged(t testing.TB, lvl log4go.Level, pattern string) *log4go.LogRecord {
+	t.Helper()
+	rec := r.Find(lvl, pattern)
+	if rec == nil {
+		t.Errorf("no %s record matching %q in:\n%s", lvl.Name(), pattern, r)
+	}
+	return rec
+}
+
+// AssertNotLogged fails the test if a record at lvl whose message matches
+// pattern has been written.
+func (r *Recorder) AssertNotLogged(t testing.TB, lvl log4go.Level, pattern string) {
+	t.Helper()
+	if rec := r.Find(lvl, pattern); rec != nil {
+		t.Errorf("unexpected %s record %q", lvl.Name(), rec.Message)
+	}
+}
+
+// AssertNoErrors fails the test if records at ERROR or above, or writer
+// errors, have been written.
+func (r *Recorder) AssertNoErrors(t testing.TB) {
+	t.Helper()
+	for _, rec := range r.Records() {
+		if rec.Level >= log4go.ERROR {
+			t.Errorf("unexpected %s record %q", rec.Level.Name(), rec.Message)
+		}
+	}
+	for _, err := range r.WriterErrors() {
+		t.Errorf("unexpected writer error: %s", err)
+	}
+}
+
+// WaitFor waits up to DefaultTimeout for a record at lvl whose message
+// matches pattern, e.g. one logged by another goroutine, and returns it.  It
+// fails the test if there is none by then.
+func (r *Recorder) WaitFor(t testing.TB, lvl log4go.Level, pattern string) *log4go.LogRecord {
+	t.Helper()
+	re := regexp.MustCompile(pattern)
+	timer := time.NewTimer(DefaultTimeout)
+	defer timer.Stop()
+
+	seen, resets := 0, 0
+	for {
+		r.mu.Lock()
+		if r.resets != resets {
+			seen, resets = 0, r.resets
+		}
+		recs, changed := r.recs[seen:], r.changed
+		r.mu.Unlock()
+		for _, rec := range recs {
+			if rec.Level == lvl && re.MatchString(rec.Message) {
+				return rec
+			}
+		}
+		seen += len(recs)
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			t.Errorf("no %s record matching %q after %s in:\n%s", lvl.Name(), pattern, DefaultTimeout, r)
+			return nil
+		}
+	}
+}
+
+// String lists the records, one per line.
+func (r *Recorder) String() string {
+	out := ""
+	for _, rec := range r.Records() {
+		out += log4go.FormatLogRecord("[%L] %M%F", rec)
+	}
+	return out
+}
+
+// Flush waits up to DefaultTimeout for the writers of logger to write their
+// records, e.g. before reading a log file, and fails the test if they do not.
+func Flush(t testing.TB, logger *log4go.Logger) {
+	t.Helper()
+	if err := logger.Flush(DefaultTimeout); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,116 @@
+/* log4gotest_test.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4gotest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gojuno/log4go"
+)
+
+// A testing.TB recording the failures instead of failing
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Error(args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprint(args...))
+}
+
+func TestRecorder(t *testing.T) {
+	l := log4go.NewLogger()
+	rec := Install(t, l, log4go.DEBUG)
+	l.SetErrorHandler(rec.HandleError)
+
+	l.Debug("starting %d", 1)
+	l.Warn("retrying charge %d", 42)
+	l.Fine("too fine")
+
+	if got := fmt.Sprint(rec.Messages()); got != "[starting 1 retrying charge 42]" {
+		t.Errorf("Messages() = %s", got)
+	}
+	if r := rec.AssertLogged(t, log4go.WARNING, `^retrying charge \d+$`); r == nil || r.Level != log4go.WARNING {
+		t.Errorf("AssertLogged returned %v", r)
+	}
+	rec.AssertNotLogged(t, log4go.FINE, "")
+	rec.AssertNoErrors(t)
+
+	ft := &fakeT{TB: t}
+	rec.AssertLogged(ft, log4go.INFO, "retrying")
+	rec.AssertNotLogged(ft, log4go.DEBUG, "^start")
+	l.Error("failed")
+	rec.HandleError(&log4go.WriterError{Writer: "w", Op: "write", Err: errors.New("disk full")})
+	rec.AssertNoErrors(ft)
+	if len(ft.errors) != 4 || !strings.Contains(ft.errors[0], "[WARN] retrying charge 42") {
+		t.Errorf("failures: %q", ft.errors)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		l.Info("async done")
+	}()
+	rec.WaitFor(t, log4go.INFO, "done$")
+
+	// A Reset while waiting restarts the scan
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		rec.Reset()
+		l.Info("after reset")
+	}()
+	rec.WaitFor(t, log4go.INFO, "after reset")
+
+	defer func(timeout time.Duration) {
+		DefaultTimeout = timeout
+	}(DefaultTimeout)
+	DefaultTimeout = 10 * time.Millisecond
+	ft = &fakeT{TB: t}
+	if rec.WaitFor(ft, log4go.INFO, "never") != nil || len(ft.errors) != 1 {
+		t.Errorf("WaitFor did not fail: %q", ft.errors)
+	}
+
+	rec.Reset()
+	if len(rec.Records()) != 0 || len(rec.WriterErrors()) != 0 {
+		t.Errorf("Reset did not forget the records")
+	}
+}
+
+func TestInstallGlobal(t *testing.T) {
+	var rec *Recorder
+	t.Run("installed", func(t *testing.T) {
+		rec = InstallGlobal(t, log4go.INFO)
+		log4go.Info("through the global logger")
+		rec.AssertLogged(t, log4go.INFO, "global")
+	})
+	log4go.Info("after the test")
+	rec.AssertNotLogged(t, log4go.INFO, "after")
+}
+
+func TestFlush(t *testing.T) {
+	const name = "_log4gotest.log"
+	l := log4go.NewLogger()
+	l.AddFilter("file", log4go.INFO, log4go.NewFileLogWriter(name, false).SetFormat("%M"))
+	defer os.Remove(name)
+	defer l.Close()
+
+	l.Info("buffered")
+	Flush(t, l)
+	if contents, err := ioutil.ReadFile(name); err != nil || string(contents) != "buffered\n" {
+		t.Errorf("read(%q): %q, %v", name, contents, err)
+	}
+}
@@ -10,123 +10,361 @@ package log4go
 
 import (
 	"bytes"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	FORMAT_DEFAULT = "[%D %T] [%L] (%S) %M"
-	FORMAT_SHORT   = "[%t %d] [%L] %M"
-	FORMAT_ABBREV  = "[%L] %M"
+	FORMAT_DEFAULT = "[%D %T] [%L] (%S) %M%F%K"
+	FORMAT_SHORT   = "[%t %d] [%L] %M%F"
+	FORMAT_ABBREV  = "[%L] %M%F"
 )
 
-type formatCacheType struct {
-	LastUpdateSeconds                int64
-	shortTime, shortDate             string
-	longTime, longTimeNano, longDate string
+// A Pattern is a format (see FormatLogRecord) compiled once, when a writer's
+// format is set or a configuration is loaded, rather than parsed for every
+// record.  It caches the formatted timestamp of the current second, and is
+// safe for concurrent use.
+type Pattern struct {
+	format   string
+	segments []patternSegment
+	parts    RecordPart
+
+	stamps atomic.Value // *timeStamps of the last record formatted
 }
 
-var formatCache = &formatCacheType{}
+// A piece of a Pattern: literal text, or the record data of a format code
+type patternSegment struct {
+	code byte // 0 for text
+	text string
+}
 
-// Known format codes:
-// %T - Time (15:04:05 MST)
-// %t - Time (15:04)
-// %D - Date (2006/01/02)
-// %d - Date (01/02/06)
-// %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
-// %S - Source
-// %M - Message
-// Ignores unknown formats
-// Recommended: "[%D %T] [%L] (%S) %M"
-func FormatLogRecord(format string, rec *LogRecord) string {
-	if rec == nil {
-		return "<nil>"
+// The timestamps of a second, as written by the format codes
+type timeStamps struct {
+	secs int64
+	loc  *time.Location
+
+	shortTime, shortDate string
+	clock, zone          string // "15:04:05" and "MST", for %T and %N
+	longTime, longDate   string
+}
+
+// The known format codes and the costly record parts they write
+var patternCodes = map[byte]RecordPart{
+	'T': 0, 'N': 0, 't': 0, 'D': 0, 'd': 0,
+	'L': 0, 'S': PART_SOURCE, 'M': 0, 'C': 0, 'F': 0,
+	'K': PART_STACK, 'X': PART_STACK,
+	'f': PART_SOURCE, 'l': PART_SOURCE, 'm': PART_SOURCE, 'P': PART_SOURCE,
+	'g': PART_GOROUTINE, 'p': 0, 'h': 0, 'e': 0, 'r': 0, 'i': 0,
+}
+
+// CompilePattern compiles format, see FormatLogRecord for its codes.  An
+// unknown code, or a % ending the format, is an error.
+func CompilePattern(format string) (*Pattern, error) {
+	p, err := compilePattern(format)
+	if err != nil {
+		return nil, err
 	}
-	if len(format) == 0 {
-		return ""
+	return p, nil
+}
+
+// MustCompilePattern is like CompilePattern but panics if format is invalid.
+func MustCompilePattern(format string) *Pattern {
+	p, err := CompilePattern(format)
+	if err != nil {
+		panic(err)
 	}
+	return p
+}
+
+// Compile format, dropping the invalid codes, and return the first of them as
+// an error along with the pattern.
+func compilePattern(format string) (*Pattern, error) {
+	p := &Pattern{format: format}
+	var err error
+	text := make([]byte, 0, len(format))
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			text = append(text, c)
+			continue
+		}
+		if i+1 == len(format) {
+			if err == nil {
+				err = fmt.Errorf("log4go: format %q ends with %%", format)
+			}
+			break
+		}
+		i++
+		c = format[i]
+		if c == '%' {
+			text = append(text, '%')
+			continue
+		}
+		part, ok := patternCodes[c]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("log4go: unknown code %%%c at offset %d of format %q", c, i-1, format)
+			}
+			continue
+		}
 
-	out := bytes.NewBuffer(make([]byte, 0, 64))
-	secs := rec.Created.UnixNano() / 1e9
-
-	cache := *formatCache
-	if cache.LastUpdateSeconds != secs {
-		month, day, year := rec.Created.Month(), rec.Created.Day(), rec.Created.Year()
-		hour, minute, second := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second()
-		nano := rec.Created.Nanosecond()
-		zone, _ := rec.Created.Zone()
-		updated := &formatCacheType{
-			LastUpdateSeconds: secs,
-			shortTime:         fmt.Sprintf("%02d:%02d", hour, minute),
-			shortDate:         fmt.Sprintf("%02d/%02d/%02d", month, day, year%100),
-			longTime:          fmt.Sprintf("%02d:%02d:%02d %s", hour, minute, second, zone),
-			longTimeNano:      fmt.Sprintf("%02d:%02d:%02d.%d %s", hour, minute, second, nano, zone),
-			longDate:          fmt.Sprintf("%04d/%02d/%02d", year, month, day),
+		if len(text) > 0 {
+			p.segments = append(p.segments, patternSegment{text: string(text)})
+			text = text[:0]
 		}
-		cache = *updated
-		formatCache = updated
+		p.segments = append(p.segments, patternSegment{code: c})
+		p.parts |= part
+	}
+	if len(text) > 0 {
+		p.segments = append(p.segments, patternSegment{text: string(text)})
 	}
+	return p, err
+}
+
+// String returns the format the Pattern was compiled from.
+func (p *Pattern) String() string {
+	return p.format
+}
+
+// RecordParts reports the costly record parts written by the Pattern.
+func (p *Pattern) RecordParts() RecordPart {
+	return p.parts
+}
+
+// Format returns rec formatted by the Pattern, followed by a newline; the
+// empty pattern formats every record as "".
+func (p *Pattern) Format(rec *LogRecord) string {
+	if p.format == "" {
+		return ""
+	}
+	out := getBuffer()
+	defer putBuffer(out)
+	p.write(out, rec)
+	return out.String()
+}
 
-	// Split the string into pieces by % signs
-	pieces := bytes.Split([]byte(format), []byte{'%'})
+// Write rec formatted by the Pattern, followed by a newline, to out.  Nothing
+// is written for the empty pattern.
+func (p *Pattern) write(out *bytes.Buffer, rec *LogRecord) {
+	if p.format == "" {
+		return
+	}
 
-	// Iterate over the pieces, replacing known formats
-	for i, piece := range pieces {
-		if i > 0 && len(piece) > 0 {
-			switch piece[0] {
+	var stamps *timeStamps
+	var num [20]byte
+	for _, seg := range p.segments {
+		switch seg.code {
+		case 0:
+			out.WriteString(seg.text)
+		case 'T', 'N', 't', 'D', 'd':
+			if stamps == nil {
+				stamps = p.timeStamps(rec.Created)
+			}
+			switch seg.code {
 			case 'T':
-				out.WriteString(cache.longTime)
+				out.WriteString(stamps.longTime)
 			case 'N':
-				out.WriteString(cache.longTimeNano)
+				out.WriteString(stamps.clock)
+				out.WriteByte('.')
+				out.Write(strconv.AppendInt(num[:0], int64(rec.Created.Nanosecond()), 10))
+				out.WriteByte(' ')
+				out.WriteString(stamps.zone)
 			case 't':
-				out.WriteString(cache.shortTime)
+				out.WriteString(stamps.shortTime)
 			case 'D':
-				out.WriteString(cache.longDate)
+				out.WriteString(stamps.longDate)
 			case 'd':
-				out.WriteString(cache.shortDate)
-			case 'L':
-				out.WriteString(levelStrings[rec.Level])
-			case 'S':
-				out.WriteString(rec.Source)
-			case 'M':
-				out.WriteString(rec.Message)
+				out.WriteString(stamps.shortDate)
+			}
+		case 'L':
+			out.WriteString(rec.Level.String())
+		case 'S':
+			out.WriteString(rec.Source)
+		case 'f':
+			if rec.Caller != nil {
+				out.WriteString(rec.Caller.ShortFile())
+			}
+		case 'l':
+			if rec.Caller != nil {
+				out.Write(strconv.AppendInt(num[:0], int64(rec.Caller.Line), 10))
 			}
-			if len(piece) > 1 {
-				out.Write(piece[1:])
+		case 'm':
+			if rec.Caller != nil {
+				out.WriteString(rec.Caller.FuncName())
+			}
+		case 'P':
+			if rec.Caller != nil {
+				out.WriteString(rec.Caller.Package())
+			}
+		case 'g':
+			out.Write(strconv.AppendUint(num[:0], rec.Goroutine, 10))
+		case 'p':
+			out.WriteString(processID)
+		case 'h':
+			out.WriteString(hostname)
+		case 'e':
+			out.WriteString(processName)
+		case 'r':
+			out.Write(strconv.AppendInt(num[:0], int64(rec.Created.Sub(processStart)/time.Millisecond), 10))
+		case 'i':
+			out.Write(strconv.AppendUint(num[:0], rec.Seq, 10))
+		case 'M':
+			out.WriteString(rec.Message)
+		case 'C':
+			out.WriteString(rec.Logger)
+		case 'F':
+			rec.Fields.writeText(out)
+		case 'K':
+			if rec.Stack != "" {
+				out.WriteByte('\n')
+				out.WriteString(rec.Stack)
+			}
+		case 'X':
+			rec.Fields.writeXML(out)
+			if rec.Stack != "" {
+				out.WriteString("<stack>")
+				xml.EscapeText(out, []byte(rec.Stack))
+				out.WriteString("</stack>")
 			}
-		} else if len(piece) > 0 {
-			out.Write(piece)
 		}
 	}
 	out.WriteByte('\n')
+}
 
-	return out.String()
+// Return the timestamps of the second of t, formatting them only for the
+// first record of the second.
+func (p *Pattern) timeStamps(t time.Time) *timeStamps {
+	secs, loc := t.Unix(), t.Location()
+	if stamps, _ := p.stamps.Load().(*timeStamps); stamps != nil && stamps.secs == secs && stamps.loc == loc {
+		return stamps
+	}
+
+	month, day, year := t.Month(), t.Day(), t.Year()
+	hour, minute, second := t.Hour(), t.Minute(), t.Second()
+	zone, _ := t.Zone()
+	stamps := &timeStamps{
+		secs:      secs,
+		loc:       loc,
+		shortTime: fmt.Sprintf("%02d:%02d", hour, minute),
+		shortDate: fmt.Sprintf("%02d/%02d/%02d", month, day, year%100),
+		clock:     fmt.Sprintf("%02d:%02d:%02d", hour, minute, second),
+		zone:      zone,
+		longDate:  fmt.Sprintf("%04d/%02d/%02d", year, month, day),
+	}
+	stamps.longTime = stamps.clock + " " + zone
+	p.stamps.Store(stamps)
+	return stamps
 }
 
-// This is the standard writer that prints to standard output.
-type FormatLogWriter chan *LogRecord
+// The patterns compiled by FormatLogRecord, by format
+var formatPatterns = struct {
+	sync.RWMutex
+	m map[string]*Pattern
+}{m: make(map[string]*Pattern)}
+
+// Formats beyond this number are compiled by every FormatLogRecord call
+const maxFormatPatterns = 64
+
+// Known format codes:
+// %T - Time (15:04:05 MST)
+// %N - Time with nanoseconds (15:04:05.999999999 MST)
+// %t - Time (15:04)
+// %D - Date (2006/01/02)
+// %d - Date (01/02/06)
+// %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
+// %S - Source (function:line)
+// %f - Source file name, without its directory
+// %l - Source line number
+// %m - Source function name, without its package (e.g. (*Logger).Info)
+// %P - Source package import path
+// %M - Message
+// %C - Category (name of the logger, empty for a root logger)
+// %g - Goroutine ID (0 if not known)
+// %p - Process ID
+// %h - Host name
+// %e - Program name (base name of os.Args[0])
+// %r - Milliseconds elapsed since the program started
+// %i - Sequence number of the record (0 if not built by a Logger)
+// %F - Fields (" key=value" for each field, nothing if the record has none)
+// %K - Stack trace (on the following lines, nothing if the record has none)
+// %X - Fields and stack trace as XML (<field name="key">value</field> for
+//      each field, <stack>trace</stack> if the record has a stack trace)
+// %% - A percent sign
+// Ignores unknown formats; use CompilePattern to detect them
+// Recommended: "[%D %T] [%L] (%S) %M%F%K"
+func FormatLogRecord(format string, rec *LogRecord) string {
+	if rec == nil {
+		return "<nil>"
+	}
+	return formatPattern(format).Format(rec)
+}
 
-// This creates a new FormatLogWriter
-func NewFormatLogWriter(out io.Writer, format string) FormatLogWriter {
-	records := make(FormatLogWriter, LogBufferLength)
-	go records.run(out, format)
-	return records
+// Return the pattern of format compiled by FormatLogRecord.
+func formatPattern(format string) *Pattern {
+	formatPatterns.RLock()
+	p, ok := formatPatterns.m[format]
+	formatPatterns.RUnlock()
+	if ok {
+		return p
+	}
+
+	p, _ = compilePattern(format)
+	formatPatterns.Lock()
+	if len(formatPatterns.m) < maxFormatPatterns {
+		formatPatterns.m[format] = p
+	}
+	formatPatterns.Unlock()
+	return p
+}
+
+// This is the standard writer that prints to standard output.
+type FormatLogWriter struct {
+	recordQueue
+	pattern *Pattern
 }
 
-func (w FormatLogWriter) run(out io.Writer, format string) {
-	for rec := range w {
-		fmt.Fprint(out, FormatLogRecord(format, rec))
+// This creates a new FormatLogWriter.  An invalid format is reported to the
+// writer's ErrorHandler, and its invalid codes are ignored.
+func NewFormatLogWriter(out io.Writer, format string) *FormatLogWriter {
+	w := &FormatLogWriter{recordQueue: newRecordQueue(LogBufferLength)}
+	var err error
+	if w.pattern, err = compilePattern(format); err != nil {
+		w.reportError("FormatLogWriter", "format", err, nil)
 	}
+	go w.run(out)
+	return w
+}
+
+// RecordParts reports the costly record parts used by the format.
+func (w *FormatLogWriter) RecordParts() RecordPart {
+	return w.pattern.parts
+}
+
+func (w *FormatLogWriter) run(out io.Writer) {
+	defer close(w.done)
+	w.serve(func(rec *LogRecord) error {
+		buf := getBuffer()
+		w.pattern.write(buf, rec)
+		out.Write(buf.Bytes())
+		putBuffer(buf)
+		return nil
+	}, nil)
 }
 
-// This is the FormatLogWriter's output method.  This will block if the output
-// buffer is full.
-func (w FormatLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+// This is the FormatLogWriter's output method.  If the output buffer is full
+// this blocks or drops a record, see SetOverflowPolicy.
+func (w *FormatLogWriter) LogWrite(rec *LogRecord) {
+	w.put(rec)
 }
 
-// Close stops the logger from sending messages to standard output.  Attempts to
-// send log messages to this logger after a Close have undefined behavior.
-func (w FormatLogWriter) Close() {
-	close(w)
+// Close stops the logger from sending messages to standard output, once the
+// buffered messages have been written.  Attempts to send log messages to this
+// logger after a Close have undefined behavior.
+func (w *FormatLogWriter) Close() {
+	w.close()
 }
@@ -0,0 +1,70 @@
+/* pool.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// The records built by the Loggers, reused once every reference is released
+var recordPool = sync.Pool{
+	New: func() interface{} { return new(LogRecord) },
+}
+
+// The number of records built by the Loggers
+var recordSeq uint64
+
+// Take a record from the pool, set it to r with the next sequence number and
+// return it with one reference, held by the caller.
+func getLogRecord(r LogRecord) *LogRecord {
+	rec := recordPool.Get().(*LogRecord)
+	*rec = r
+	rec.Seq = atomic.AddUint64(&recordSeq, 1)
+	rec.refs = 1
+	rec.pooled = true
+	return rec
+}
+
+// Retain adds a reference to the record, to be given up with Release.  A
+// LogWriter already holds a reference to the records it is handed (see
+// LogWriter), it retains one only to pass it on while still using it.
+func (rec *LogRecord) Retain() {
+	atomic.AddInt32(&rec.refs, 1)
+}
+
+// Release gives up a reference to the record.  Once the last one is released,
+// a record built by a Logger goes back to the pool and must not be used any
+// more.  Records built otherwise are left to the garbage collector.
+func (rec *LogRecord) Release() {
+	if atomic.AddInt32(&rec.refs, -1) == 0 && rec.pooled {
+		*rec = LogRecord{}
+		recordPool.Put(rec)
+	}
+}
+
+// The buffers records are formatted into
+var bufferPool = sync.Pool{
+	New: func() interface{} { return bytes.NewBuffer(make([]byte, 0, 256)) },
+}
+
+// Buffers grown beyond this size are not reused
+const maxPooledBuffer = 64 << 10
+
+// Take an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// Give the buffer back to the pool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
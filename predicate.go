@@ -0,0 +1,100 @@
+/* predicate.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A Predicate selects the records written by a Filter, in addition to its
+// level (see Logger.SetMatch).  Predicates are called concurrently and must
+// not modify the record.
+type Predicate func(rec *LogRecord) bool
+
+// LevelRange matches the records from min to max inclusive.
+func LevelRange(min, max Level) Predicate {
+	return func(rec *LogRecord) bool {
+		return rec.Level >= min && rec.Level <= max
+	}
+}
+
+// MatchSource matches the records whose whole source ("package.Function:line")
+// matches the glob, in which '*' matches any sequence of characters and '?'
+// any single character, e.g. "net/http.*".
+func MatchSource(glob string) (Predicate, error) {
+	expr := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(glob)) + "$"
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source glob %q: %s", glob, err)
+	}
+	return func(rec *LogRecord) bool {
+		return re.MatchString(rec.Source)
+	}, nil
+}
+
+// MatchMessage matches the records whose message contains a match of the
+// regular expression.
+func MatchMessage(expr string) (Predicate, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(rec *LogRecord) bool {
+		return re.MatchString(rec.Message)
+	}, nil
+}
+
+// MatchField matches the records with a field named key whose value, as
+// printed by fmt.Sprint, contains a match of the regular expression.
+func MatchField(key, expr string) (Predicate, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(rec *LogRecord) bool {
+		for _, f := range rec.Fields {
+			if f.Key == key && re.MatchString(fmt.Sprint(f.Value)) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// All matches the records matched by every one of preds (all records if there
+// are none).
+func All(preds ...Predicate) Predicate {
+	return func(rec *LogRecord) bool {
+		for _, p := range preds {
+			if !p(rec) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any matches the records matched by at least one of preds.
+func Any(preds ...Predicate) Predicate {
+	return func(rec *LogRecord) bool {
+		for _, p := range preds {
+			if p(rec) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches the records not matched by p, e.g. Not(MatchMessage("health"))
+// excludes health-check noise.
+func Not(p Predicate) Predicate {
+	return func(rec *LogRecord) bool {
+		return !p(rec)
+	}
+}
@@ -0,0 +1,245 @@
+/* queue.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy selects what a writer does with a record when its buffer
+// (of LogBufferLength records) is full.
+type OverflowPolicy int
+
+const (
+	OVERFLOW_BLOCK         OverflowPolicy = iota // wait for room (the default)
+	OVERFLOW_DROP_NEWEST                         // drop the record being written
+	OVERFLOW_DROP_OLDEST                         // drop the oldest buffered record to make room
+	OVERFLOW_BLOCK_TIMEOUT                       // wait for room up to a timeout, then drop the record
+)
+
+// The buffer of records between the Logger and the goroutine of a writer,
+// embedded by the writers of this package.  The goroutine closes done when it
+// ends.
+type recordQueue struct {
+	// First for their alignment (see sync/atomic); writers embed the queue
+	// before their other fields, after their own atomic counters
+	dropped uint64 // records dropped, accessed atomically
+	pending uint64 // records dropped and not reported yet, accessed atomically
+
+	records chan *LogRecord
+	flushes chan chan bool
+	done    chan bool
+	policy  OverflowPolicy
+	timeout time.Duration
+	report  bool
+	onError ErrorHandler // set with SetErrorHandler
+	inherit atomic.Value // ErrorHandler of the Logger the writer was added to
+}
+
+func newRecordQueue(size int) recordQueue {
+	return recordQueue{
+		records: make(chan *LogRecord, size),
+		flushes: make(chan chan bool),
+		done:    make(chan bool),
+	}
+}
+
+// SetOverflowPolicy sets what the writer does with records written while its
+// buffer is full; timeout is used by OVERFLOW_BLOCK_TIMEOUT.  Must be called
+// before the first log message is written.
+func (q *recordQueue) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	q.policy = policy
+	q.timeout = timeout
+}
+
+// SetDropReport enables writing a WARNING record telling how many records
+// were dropped, once the buffer has room again.  Must be called before the
+// first log message is written.
+func (q *recordQueue) SetDropReport(report bool) {
+	q.report = report
+}
+
+// SetErrorHandler sets the handler of the writer's failures, overriding the
+// ErrorHandler of the Logger it is added to.  Must be called before the first
+// log message is written.
+func (q *recordQueue) SetErrorHandler(h ErrorHandler) {
+	q.onError = h
+}
+
+func (q *recordQueue) setLoggerErrorHandler(h ErrorHandler) {
+	q.inherit.Store(h)
+}
+
+// Pass a failure of the writer to its ErrorHandler.
+func (q *recordQueue) reportError(writer, op string, err error, rec *LogRecord) {
+	if rec != nil {
+		rec.Retain() // kept by the error
+	}
+	e := &WriterError{Writer: writer, Op: op, Err: err, Record: rec}
+	if q.onError != nil {
+		q.onError(e)
+	} else if h, _ := q.inherit.Load().(ErrorHandler); h != nil {
+		h(e)
+	} else {
+		DefaultErrorHandler(e)
+	}
+}
+
+// Dropped returns the number of records dropped because the buffer was full.
+func (q *recordQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// WriterStats returns the counters of the writer.
+func (q *recordQueue) WriterStats() WriterStats {
+	return WriterStats{
+		Dropped:    q.Dropped(),
+		QueueDepth: len(q.records),
+	}
+}
+
+// Queue rec according to the overflow policy.  The records are released once
+// written or dropped.
+func (q *recordQueue) put(rec *LogRecord) {
+	if !q.offer(rec) {
+		rec.Release()
+		atomic.AddUint64(&q.dropped, 1)
+		atomic.AddUint64(&q.pending, 1)
+		return
+	}
+
+	if q.report && atomic.LoadUint64(&q.pending) > 0 {
+		n := atomic.SwapUint64(&q.pending, 0)
+		report := &LogRecord{
+			Level:   WARNING,
+			Created: time.Now(),
+			Message: fmt.Sprintf("%d records dropped", n),
+		}
+		select {
+		case q.records <- report:
+		default:
+			atomic.AddUint64(&q.pending, n)
+		}
+	}
+}
+
+// Try to queue rec, and report whether it has been.
+func (q *recordQueue) offer(rec *LogRecord) bool {
+	select {
+	case q.records <- rec:
+		return true
+	default:
+	}
+
+	switch q.policy {
+	case OVERFLOW_DROP_NEWEST:
+		return false
+	case OVERFLOW_DROP_OLDEST:
+		// An unbuffered writer has nothing to drop and blocks like OVERFLOW_BLOCK
+		for cap(q.records) > 0 {
+			select {
+			case old := <-q.records:
+				old.Release()
+				atomic.AddUint64(&q.dropped, 1)
+				atomic.AddUint64(&q.pending, 1)
+			default:
+			}
+			select {
+			case q.records <- rec:
+				return true
+			default:
+			}
+		}
+	case OVERFLOW_BLOCK_TIMEOUT:
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		select {
+		case q.records <- rec:
+			return true
+		case <-timer.C:
+			return false
+		case <-q.done:
+			return false
+		}
+	}
+
+	// A writer which stopped on an error takes no more records
+	select {
+	case q.records <- rec:
+		return true
+	case <-q.done:
+		return false
+	}
+}
+
+// Hand the queued records to write until the queue is closed or write fails,
+// calling sync (if not nil) once the records queued before a Flush have been
+// written.
+func (q *recordQueue) serve(write func(rec *LogRecord) error, sync func()) {
+	for {
+		select {
+		case rec, ok := <-q.records:
+			if !ok || writeRecord(write, rec) != nil {
+				return
+			}
+		case ack := <-q.flushes:
+			ok := q.drain(write)
+			if sync != nil {
+				sync()
+			}
+			close(ack)
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// Hand the records currently queued to write.  Returns false if the queue is
+// closed or write failed.
+func (q *recordQueue) drain(write func(rec *LogRecord) error) bool {
+	for {
+		select {
+		case rec, ok := <-q.records:
+			if !ok || writeRecord(write, rec) != nil {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// Hand rec to write and release it.
+func writeRecord(write func(rec *LogRecord) error, rec *LogRecord) error {
+	err := write(rec)
+	rec.Release()
+	return err
+}
+
+// Flush returns once the records written before the call have been written
+// out, or the writer has stopped.
+func (q *recordQueue) Flush() {
+	ack := make(chan bool)
+	select {
+	case q.flushes <- ack:
+	case <-q.done:
+		return
+	}
+	select {
+	case <-ack:
+	case <-q.done:
+	}
+}
+
+// Close the buffer and wait for the writer's goroutine to write the buffered
+// records and end.
+func (q *recordQueue) close() {
+	close(q.records)
+	<-q.done
+}
@@ -0,0 +1,86 @@
+/* recover.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// RecoverPolicy selects what Recover does once a panic has been logged.
+type RecoverPolicy int
+
+const (
+	RECOVER_REPANIC  RecoverPolicy = iota // panic again with the same value (the default)
+	RECOVER_CONTINUE                      // return normally
+)
+
+// Recover logs a panic of the calling goroutine through logger at CRITICAL,
+// with the panic value and the stack trace of the panic, and flushes the
+// writers of logger's hierarchy (up to the FlushTimeout of its
+// TerminationPolicy) so that the record is written before the program dies.
+// It must be deferred directly:
+//
+//   defer log4go.Recover(logger)
+//
+// The panic then goes on through the Panic function of the policy, unless
+// RECOVER_CONTINUE is given.
+func Recover(logger *Logger, policy ...RecoverPolicy) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	logger.logPanic(v)
+	p := logger.TerminationPolicy()
+	logger.root().Flush(p.FlushTimeout)
+
+	if len(policy) == 0 || policy[0] == RECOVER_REPANIC {
+		if p.Panic != nil {
+			p.Panic(v)
+		} else {
+			panic(v)
+		}
+	}
+}
+
+// Go runs fn in a new goroutine whose panics are logged by Recover.
+func Go(logger *Logger, fn func(), policy ...RecoverPolicy) {
+	go func() {
+		defer Recover(logger, policy...)
+		fn()
+	}()
+}
+
+// Log the panic value v at CRITICAL, attributed to the function which
+// panicked.  Must be called by the deferred function handling the panic.
+func (log *Logger) logPanic(v interface{}) {
+	// Determine if any logging will be done
+	write, parts := log.wants(CRITICAL)
+	if !write {
+		return
+	}
+
+	// Make the log record, with its stack, and dispatch it
+	parts |= PART_SOURCE | PART_STACK
+	log.emit(log.newRecord(CRITICAL, parts, fmt.Sprintf("panic: %v", v), nil, callSite{skip: 1, trim: panicFrames}))
+}
+
+// Drop the frames up to the panic and those of the runtime raising it, so that
+// the record is attributed to the function which panicked.
+func panicFrames(frames []runtime.Frame) []runtime.Frame {
+	for i, frame := range frames {
+		if frame.Function == "runtime.gopanic" {
+			frames = frames[i+1:]
+			break
+		}
+	}
+	for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "runtime.") {
+		frames = frames[1:]
+	}
+	return frames
+}
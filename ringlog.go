@@ -0,0 +1,102 @@
+/* ringlog.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"sync"
+)
+
+// This log writer keeps the last records in memory and writes them only when
+// a record at or above a trigger level arrives, so that the records leading to
+// an error are written even though their level is not normally logged.  Flush
+// does not write the kept records.
+type RingLogWriter struct {
+	wrappedWriter
+	trigger Level
+
+	mu   sync.Mutex
+	ring []*LogRecord // the last records, ring[next] is the oldest once full
+	next int
+	full bool
+}
+
+// NewRingLogWriter creates a LogWriter keeping the last size records of every
+// level.  A record at or above trigger is written to writer preceded by the
+// kept records, which are then discarded.  The filter of the writer should
+// accept the levels to keep, e.g.
+//
+//   log.AddFilter("ring", FINEST, NewRingLogWriter(NewFileLogWriter("errors.log", false), 1000, ERROR))
+func NewRingLogWriter(writer LogWriter, size int, trigger Level) *RingLogWriter {
+	if size < 0 {
+		size = 0
+	}
+	return &RingLogWriter{
+		wrappedWriter: wrappedWriter{writer: writer},
+		trigger:       trigger,
+		ring:          make([]*LogRecord, size),
+	}
+}
+
+// This is the RingLogWriter's output method.
+func (w *RingLogWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if rec.Level < w.trigger {
+		if len(w.ring) == 0 {
+			rec.Release()
+			return
+		}
+		if w.full {
+			w.ring[w.next].Release()
+		}
+		w.ring[w.next] = rec
+		w.next = (w.next + 1) % len(w.ring)
+		w.full = w.full || w.next == 0
+		return
+	}
+
+	// Write the history in order, then the trigger record
+	if w.full {
+		w.write(w.ring[w.next:])
+	}
+	w.write(w.ring[:w.next])
+	w.next, w.full = 0, false
+	w.writer.LogWrite(rec)
+}
+
+// Write and forget the records of list
+func (w *RingLogWriter) write(list []*LogRecord) {
+	for i, rec := range list {
+		w.writer.LogWrite(rec)
+		list[i] = nil
+	}
+}
+
+// Len returns the number of records kept.
+func (w *RingLogWriter) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.full {
+		return len(w.ring)
+	}
+	return w.next
+}
+
+// Close discards the kept records and closes the wrapped LogWriter.
+func (w *RingLogWriter) Close() {
+	w.mu.Lock()
+	for i, rec := range w.ring {
+		if rec != nil {
+			rec.Release()
+		}
+		w.ring[i] = nil
+	}
+	w.next, w.full = 0, false
+	w.mu.Unlock()
+
+	w.writer.Close()
+}
@@ -0,0 +1,142 @@
+/* sampling.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type samplingKey struct {
+	source string
+	level  Level
+}
+
+type samplingCount struct {
+	start      time.Time // start of the current interval
+	count      int       // records seen in the current interval
+	suppressed int       // records suppressed since the last summary
+}
+
+// This log writer limits the rate of records passed to another LogWriter.
+// Records are grouped by source and level: within each interval the first
+// records of a group are written, then only one in every thereafter.  Once per
+// interval a summary record is written for each group which had records
+// suppressed.
+type SamplingLogWriter struct {
+	wrappedWriter
+	first      int
+	thereafter int
+	interval   time.Duration
+
+	mu     sync.Mutex
+	counts map[samplingKey]*samplingCount
+
+	stop chan bool
+	done chan bool
+}
+
+// NewSamplingLogWriter wraps writer so that within each interval only the
+// first records from a source at a level are written, followed by every
+// thereafter-th one (none if thereafter is 0).
+func NewSamplingLogWriter(writer LogWriter, first, thereafter int, interval time.Duration) *SamplingLogWriter {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	w := &SamplingLogWriter{
+		// The source is needed to group records
+		wrappedWriter: wrappedWriter{writer: writer, parts: PART_SOURCE},
+		first:         first,
+		thereafter:    thereafter,
+		interval:      interval,
+		counts:        make(map[samplingKey]*samplingCount),
+		stop:          make(chan bool),
+		done:          make(chan bool),
+	}
+	go w.run()
+	return w
+}
+
+func (w *SamplingLogWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.summarize(time.Now())
+		case <-w.stop:
+			w.summarize(time.Now())
+			return
+		}
+	}
+}
+
+// Write a summary record for each group with suppressed records, and forget
+// the groups which have been quiet for an interval.
+func (w *SamplingLogWriter) summarize(now time.Time) {
+	var summaries []*LogRecord
+
+	w.mu.Lock()
+	for key, c := range w.counts {
+		if c.suppressed > 0 {
+			summaries = append(summaries, &LogRecord{
+				Level:   key.level,
+				Created: now,
+				Source:  key.source,
+				Message: fmt.Sprintf("%d similar records suppressed by sampling", c.suppressed),
+			})
+			c.suppressed = 0
+		} else if now.Sub(c.start) >= w.interval {
+			delete(w.counts, key)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, rec := range summaries {
+		w.writer.LogWrite(rec)
+	}
+}
+
+// Report whether rec is to be written rather than suppressed.
+func (w *SamplingLogWriter) sample(rec *LogRecord) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := samplingKey{rec.Source, rec.Level}
+	c, ok := w.counts[key]
+	if !ok {
+		c = &samplingCount{start: rec.Created}
+		w.counts[key] = c
+	} else if rec.Created.Sub(c.start) >= w.interval {
+		c.start, c.count = rec.Created, 0
+	}
+
+	c.count++
+	if c.count <= w.first || (w.thereafter > 0 && (c.count-w.first)%w.thereafter == 0) {
+		return true
+	}
+	c.suppressed++
+	return false
+}
+
+// This is the SamplingLogWriter's output method
+func (w *SamplingLogWriter) LogWrite(rec *LogRecord) {
+	if w.sample(rec) {
+		w.writer.LogWrite(rec)
+	} else {
+		rec.Release()
+	}
+}
+
+// Close writes the final summary and closes the wrapped LogWriter.
+func (w *SamplingLogWriter) Close() {
+	close(w.stop)
+	<-w.done
+	w.writer.Close()
+}
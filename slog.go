@@ -0,0 +1,233 @@
+//go:build go1.21
+
+/* slog.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+/****** Level mapping ******/
+
+// The slog levels of the built-in levels.  Other levels are interpolated.
+var slogLevels = []struct {
+	lvl  Level
+	slog slog.Level
+}{
+	{FINEST, slog.LevelDebug - 8},
+	{FINE, slog.LevelDebug - 4},
+	{DEBUG, slog.LevelDebug},
+	{TRACE, slog.LevelDebug + 2},
+	{INFO, slog.LevelInfo},
+	{WARNING, slog.LevelWarn},
+	{ERROR, slog.LevelError},
+	{CRITICAL, slog.LevelError + 4},
+}
+
+// SlogLevel returns the slog level of lvl: DEBUG, INFO, WARNING and ERROR are
+// their slog counterparts, FINEST and FINE are below slog.LevelDebug, TRACE is
+// between slog.LevelDebug and slog.LevelInfo and CRITICAL is slog.LevelError+4.
+// Custom levels are mapped proportionally, e.g. INFO+5 to slog.LevelInfo+2.
+func SlogLevel(lvl Level) slog.Level {
+	i := 1
+	for i < len(slogLevels)-1 && lvl > slogLevels[i].lvl {
+		i++
+	}
+	lo, hi := slogLevels[i-1], slogLevels[i]
+	return lo.slog + slog.Level(int(lvl-lo.lvl)*int(hi.slog-lo.slog)/int(hi.lvl-lo.lvl))
+}
+
+// LevelFromSlog returns the highest registered level whose SlogLevel is not
+// above l, or the lowest registered level.
+func LevelFromSlog(l slog.Level) Level {
+	list := registeredLevels()
+	lvl := list[0]
+	for _, r := range list[1:] {
+		if SlogLevel(r) > l {
+			break
+		}
+		lvl = r
+	}
+	return lvl
+}
+
+/****** slog.Handler ******/
+
+// SlogHandler is an slog.Handler logging the slog records through a Logger,
+// so that they go through its hooks and filters.  The attributes become the
+// fields of the records, with the names of their groups as dotted prefixes
+// (e.g. "request.id").
+type SlogHandler struct {
+	log    *Logger
+	fields Fields // from WithAttrs
+	prefix string // from WithGroup, e.g. "request."
+}
+
+// NewSlogHandler returns an slog.Handler logging through logger, e.g.
+//
+//   slog.SetDefault(slog.New(log4go.NewSlogHandler(log4go.Global)))
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{log: logger}
+}
+
+// Enabled reports whether a filter of the Logger accepts records at l.
+func (h *SlogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	write, _ := h.log.wants(LevelFromSlog(l))
+	return write
+}
+
+// Handle logs r through the Logger, with the fields the registered
+// ContextExtractors find in ctx.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	lvl := LevelFromSlog(r.Level)
+
+	// Determine if any logging will be done
+	write, parts := h.log.wants(lvl)
+	if !write {
+		return nil
+	}
+
+	fields := h.fields
+	if r.NumAttrs() > 0 {
+		more := make(Fields, 0, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			more = appendAttr(more, h.prefix, a)
+			return true
+		})
+		fields = fields.concat(more)
+	}
+	if ctx != nil {
+		fields = fields.concat(contextFields(ctx))
+	}
+
+	// The record has no source without a PC.  The trace starts at the first
+	// caller outside log/slog.
+	if r.PC == 0 {
+		parts &^= PART_SOURCE
+	}
+	rec := h.log.newRecord(lvl, parts, r.Message, fields, callSite{skip: 1, pc: r.PC, trim: slogFrames})
+	if !r.Time.IsZero() {
+		rec.Created = r.Time
+	}
+
+	// Dispatch the log record
+	h.log.emit(rec)
+	return nil
+}
+
+// Drop the frames of log/slog, so that the traces start at its caller.
+func slogFrames(frames []runtime.Frame) []runtime.Frame {
+	for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "log/slog.") {
+		frames = frames[1:]
+	}
+	return frames
+}
+
+// WithAttrs returns a handler adding attrs to the fields of the records.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := make(Fields, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.prefix, a)
+	}
+	return &SlogHandler{log: h.log, fields: h.fields.concat(fields), prefix: h.prefix}
+}
+
+// WithGroup returns a handler qualifying the keys of the attributes added
+// afterwards with name.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{log: h.log, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+// Append the fields of a, flattening groups, as slog handlers do: empty
+// attributes are ignored and the attributes of a group without a key are
+// inlined.
+func appendAttr(fields Fields, prefix string, a slog.Attr) Fields {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+/****** LogWriter ******/
+
+// This log writer forwards the records to an slog.Handler.  The fields of a
+// record become its attributes, followed by "logger", "source" and "stack"
+// attributes when the record has them.
+type SlogLogWriter struct {
+	handler slog.Handler
+	inherit atomic.Value // ErrorHandler of the Logger the writer was added to
+}
+
+// NewSlogLogWriter creates a LogWriter forwarding the records to handler at
+// their SlogLevel.
+func NewSlogLogWriter(handler slog.Handler) *SlogLogWriter {
+	return &SlogLogWriter{handler: handler}
+}
+
+// This is the SlogLogWriter's output method.  The records are handed to the
+// handler synchronously.
+func (w *SlogLogWriter) LogWrite(rec *LogRecord) {
+	defer rec.Release()
+
+	ctx := context.Background()
+	lvl := SlogLevel(rec.Level)
+	if !w.handler.Enabled(ctx, lvl) {
+		return
+	}
+
+	r := slog.NewRecord(rec.Created, lvl, rec.Message, 0)
+	for _, f := range rec.Fields {
+		r.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	if rec.Logger != "" {
+		r.AddAttrs(slog.String("logger", rec.Logger))
+	}
+	if rec.Source != "" {
+		r.AddAttrs(slog.String(slog.SourceKey, rec.Source))
+	}
+	if rec.Stack != "" {
+		r.AddAttrs(slog.String("stack", rec.Stack))
+	}
+
+	if err := w.handler.Handle(ctx, r); err != nil {
+		rec.Retain() // kept by the error
+		e := &WriterError{Writer: "SlogLogWriter", Op: "handle", Err: err, Record: rec}
+		if h, _ := w.inherit.Load().(ErrorHandler); h != nil {
+			h(e)
+		} else {
+			DefaultErrorHandler(e)
+		}
+	}
+}
+
+// Close does nothing, the handler is not closed.
+func (w *SlogLogWriter) Close() {
+}
+
+func (w *SlogLogWriter) setLoggerErrorHandler(h ErrorHandler) {
+	w.inherit.Store(h)
+}
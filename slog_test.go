@@ -0,0 +1,124 @@
+//go:build go1.21
+
+/* slog_test.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLevel(t *testing.T) {
+	for lvl, want := range map[Level]slog.Level{
+		FINEST:       slog.LevelDebug - 8,
+		DEBUG:        slog.LevelDebug,
+		TRACE:        slog.LevelDebug + 2,
+		INFO:         slog.LevelInfo,
+		INFO + 5:     slog.LevelInfo + 2,
+		WARNING:      slog.LevelWarn,
+		ERROR:        slog.LevelError,
+		CRITICAL:     slog.LevelError + 4,
+		CRITICAL + 5: slog.LevelError + 6,
+	} {
+		if got := SlogLevel(lvl); got != want {
+			t.Errorf("SlogLevel(%d) = %s, want %s", lvl, got, want)
+		}
+	}
+
+	for l, want := range map[slog.Level]Level{
+		slog.LevelDebug - 100: FINEST,
+		slog.LevelDebug - 3:   FINE,
+		slog.LevelDebug:       DEBUG,
+		slog.LevelInfo:        INFO,
+		slog.LevelWarn:        WARNING,
+		slog.LevelError:       ERROR,
+		slog.LevelError + 4:   CRITICAL,
+	} {
+		if got := LevelFromSlog(l); got != want {
+			t.Errorf("LevelFromSlog(%s) = %s, want %s", l, got, want)
+		}
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	l := NewLogger()
+	rec := &recordingWriter{}
+	l.AddFilter("rec", INFO, rec)
+	l.SetStackLevel("rec", ERROR)
+
+	h := NewSlogHandler(l.GetLogger("new"))
+	if h.Enabled(context.Background(), slog.LevelDebug) || !h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Errorf("Enabled does not follow the filters")
+	}
+
+	sl := slog.New(h)
+	sl.Debug("not written")
+	sl.With("a", 1).WithGroup("req").With("id", 7).Info("hello", "k", "v", slog.Group("g", "x", 1), slog.Group("", "inline", true))
+	sl.WithGroup("empty").Error("failed", slog.Attr{})
+	l.Close()
+
+	if len(rec.recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(rec.recs))
+	}
+	r := rec.recs[0]
+	if r.Level != INFO || r.Message != "hello" || r.Logger != "new" || !strings.Contains(r.Source, ".TestSlogHandler:") {
+		t.Errorf("record: %+v", r)
+	}
+	if got, want := r.Fields.String(), "a=1 req.id=7 req.k=v req.g.x=1 req.inline=true"; got != want {
+		t.Errorf("fields: got %q, want %q", got, want)
+	}
+	if r = rec.recs[1]; r.Level != ERROR || len(r.Fields) != 0 || !strings.HasPrefix(r.Stack, "github.com/gojuno/log4go.TestSlogHandler\n") {
+		t.Errorf("error record: %+v", r)
+	}
+}
+
+type failingHandler struct {
+	slog.Handler
+}
+
+func (h failingHandler) Handle(ctx context.Context, r slog.Record) error {
+	return errors.New("handler failed")
+}
+
+func TestSlogLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "stack" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	l := NewLogger()
+	l.AddFilter("slog", FINEST, NewSlogLogWriter(h))
+	l.Log(FINE, "src", "below the handler level")
+	l.With("user", 7).Info("hi")
+	l.GetLogger("db").Log(CRITICAL, "src", "down")
+	l.Close()
+
+	want := "level=INFO msg=hi user=7 source=github.com/gojuno/log4go.TestSlogLogWriter:"
+	if got := buf.String(); !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "\nlevel=ERROR+4 msg=down logger=db source=src\n") {
+		t.Errorf("got %q", got)
+	}
+
+	var errs []*WriterError
+	l = NewLogger()
+	l.SetErrorHandler(func(err *WriterError) { errs = append(errs, err) })
+	l.AddFilter("slog", FINEST, NewSlogLogWriter(failingHandler{h}))
+	l.Info("lost")
+	l.Close()
+	if len(errs) != 1 || errs[0].Op != "handle" || errs[0].Record.Message != "lost" {
+		t.Errorf("errors: %v", errs)
+	}
+}
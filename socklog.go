@@ -12,52 +12,95 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
-	"os"
+	"sync/atomic"
 )
 
-// This log writer sends output to a socket
-type SocketLogWriter chan *LogRecord
+// This log writer sends output to a socket.  When sending a record fails it
+// reconnects once and sends the record again.
+type SocketLogWriter struct {
+	reconnects uint64 // accessed atomically
 
-// This is the SocketLogWriter's output method
-func (w SocketLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+	recordQueue
 }
 
-func (w SocketLogWriter) Close() {
-	close(w)
+// This is the SocketLogWriter's output method.  If the output buffer is full
+// this blocks or drops a record, see SetOverflowPolicy.
+func (w *SocketLogWriter) LogWrite(rec *LogRecord) {
+	w.put(rec)
 }
 
-func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
-	sock, err := net.Dial(proto, hostport)
+// Close stops the writer once the buffered records have been sent and closes
+// the socket.
+func (w *SocketLogWriter) Close() {
+	w.close()
+}
+
+func NewSocketLogWriter(proto, hostport string) *SocketLogWriter {
+	w, err := newSocketLogWriter(proto, hostport)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", hostport, err)
+		DefaultErrorHandler(err)
 		return nil
 	}
+	return w
+}
+
+// Create a SocketLogWriter, returning a failure to dial instead of reporting
+// it.
+func newSocketLogWriter(proto, hostport string) (*SocketLogWriter, *WriterError) {
+	w := &SocketLogWriter{recordQueue: newRecordQueue(LogBufferLength)}
+	name := fmt.Sprintf("SocketLogWriter(%q)", hostport)
 
-	w := SocketLogWriter(make(chan *LogRecord, LogBufferLength))
+	sock, err := net.Dial(proto, hostport)
+	if err != nil {
+		return nil, &WriterError{Writer: name, Op: "dial", Err: err}
+	}
 
 	go func() {
+		defer close(w.done)
 		defer func() {
 			if sock != nil && proto == "tcp" {
 				sock.Close()
 			}
 		}()
 
-		for rec := range w {
+		w.serve(func(rec *LogRecord) error {
 			// Marshall into JSON
 			js, err := json.Marshal(rec)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
-				return
+				w.reportError(name, "marshal", err, rec)
+				return err
 			}
 
 			_, err = sock.Write(js)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
-				return
+				w.reportError(name, "write", err, rec)
+
+				sock.Close()
+				if sock, err = net.Dial(proto, hostport); err != nil {
+					w.reportError(name, "dial", err, rec)
+					return err
+				}
+				atomic.AddUint64(&w.reconnects, 1)
+				if _, err = sock.Write(js); err != nil {
+					w.reportError(name, "write", err, rec)
+				}
 			}
-		}
+			return err
+		}, nil)
 	}()
 
-	return w
+	return w, nil
+}
+
+// RecordParts reports the record parts sent.  The goroutine ID is not looked
+// up for the socket.
+func (w *SocketLogWriter) RecordParts() RecordPart {
+	return PART_SOURCE | PART_STACK
+}
+
+// WriterStats returns the counters of the writer.
+func (w *SocketLogWriter) WriterStats() WriterStats {
+	stats := w.recordQueue.WriterStats()
+	stats.Reconnects = atomic.LoadUint64(&w.reconnects)
+	return stats
 }
@@ -0,0 +1,60 @@
+/* stack.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"runtime"
+)
+
+// STACK_NONE disables stack traces when used as the StackLevel of a filter.
+const STACK_NONE Level = math.MaxInt32
+
+// Return the stack trace of the calling goroutine, starting at the frame
+// runtime.Caller(skip) would report from the caller of captureStack.
+func captureStack(skip int) string {
+	return formatStack(callerFrames(skip + 1))
+}
+
+// Return the frames of the calling goroutine, starting at the frame
+// runtime.Caller(skip) would report from the caller of callerFrames.
+func callerFrames(skip int) []runtime.Frame {
+	pcs := make([]uintptr, 32)
+	for {
+		n := runtime.Callers(skip+2, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+
+	list := make([]runtime.Frame, 0, len(pcs))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		list = append(list, frame)
+		if !more {
+			break
+		}
+	}
+	return list
+}
+
+// Format a stack trace.  Each frame takes two lines, the function name and
+// its tab indented file:line, as in the traces printed for a panic.
+func formatStack(frames []runtime.Frame) string {
+	out := bytes.NewBuffer(make([]byte, 0, 1024))
+	for _, frame := range frames {
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		fmt.Fprintf(out, "%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+	}
+	return out.String()
+}
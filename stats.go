@@ -0,0 +1,97 @@
+/* stats.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ExpvarName is the expvar variable under which the Stats of Global are
+// published (see /debug/vars).
+const ExpvarName = "log4go"
+
+func init() {
+	expvar.Publish(ExpvarName, expvar.Func(func() interface{} {
+		return Global.Stats()
+	}))
+}
+
+// WriterStats holds the counters of a LogWriter.  The counters which do not
+// apply to a writer are 0.
+type WriterStats struct {
+	Dropped    uint64 `json:"dropped"`              // records dropped because the buffer was full
+	QueueDepth int    `json:"queue_depth"`          // records currently buffered
+	Bytes      uint64 `json:"bytes,omitempty"`      // bytes written (files)
+	Rotations  uint64 `json:"rotations,omitempty"`  // rotations performed (files)
+	Reconnects uint64 `json:"reconnects,omitempty"` // reconnections (sockets)
+}
+
+// A LogWriter may implement StatsLogWriter to report its counters in Stats.
+type StatsLogWriter interface {
+	LogWriter
+
+	WriterStats() WriterStats
+}
+
+// FilterStats is a snapshot of the counters of a filter and its LogWriter.
+type FilterStats struct {
+	Logger   string            `json:"logger"`   // name of the logger, "" for a root
+	Filter   string            `json:"filter"`   // name of the filter
+	Accepted map[string]uint64 `json:"accepted"` // records handed to the writer by level
+	Writer   *WriterStats      `json:"writer,omitempty"`
+}
+
+// The counters of a filter, accessed atomically.
+type filterStats struct {
+	accepted sync.Map // Level -> *uint64
+}
+
+func (s *filterStats) accept(lvl Level) {
+	n, ok := s.accepted.Load(lvl)
+	if !ok {
+		n, _ = s.accepted.LoadOrStore(lvl, new(uint64))
+	}
+	atomic.AddUint64(n.(*uint64), 1)
+}
+
+// Stats returns a snapshot of the counters of the filters of the Logger and,
+// for a root logger, of its named loggers, sorted by logger and filter name.
+func (log *Logger) Stats() []FilterStats {
+	loggers := []*Logger{log}
+	if log.parent == nil {
+		loggers = append(loggers, log.Loggers()...)
+	}
+
+	list := []FilterStats{}
+	for _, l := range loggers {
+		start := len(list)
+		l.mu.RLock()
+		for name, filt := range l.filters {
+			fs := FilterStats{
+				Logger:   l.name,
+				Filter:   name,
+				Accepted: make(map[string]uint64),
+			}
+			filt.stats.accepted.Range(func(lvl, n interface{}) bool {
+				fs.Accepted[levelToString(lvl.(Level))] = atomic.LoadUint64(n.(*uint64))
+				return true
+			})
+			if sw, ok := filt.LogWriter.(StatsLogWriter); ok {
+				ws := sw.WriterStats()
+				fs.Writer = &ws
+			}
+			list = append(list, fs)
+		}
+		l.mu.RUnlock()
+
+		named := list[start:]
+		sort.Slice(named, func(i, j int) bool { return named[i].Filter < named[j].Filter })
+	}
+	return list
+}
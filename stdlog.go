@@ -0,0 +1,96 @@
+/* stdlog.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"io"
+	stdlog "log"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// The header the standard log package writes before the message, depending
+// on its flags: date, time (with microseconds) and file:line.
+var stdLogHeader = regexp.MustCompile(`^(\d{4}/\d\d/\d\d )?(\d\d:\d\d:\d\d(\.\d+)? )?(\S+\.go:\d+: )?`)
+
+// A level at the start of a message, as "[WARN] " or "error: "
+var stdLogLevel = regexp.MustCompile(`^(\[(\w+)\]:?|(\w+):) `)
+
+// This writer turns the lines written by a standard library *log.Logger into
+// records of a Logger.
+type stdLogWriter struct {
+	log *Logger
+	lvl Level
+}
+
+// NewStdLogWriter returns an io.Writer logging every line written to it by a
+// standard library *log.Logger through logger at lvl.  The date, time and
+// file:line written by the log package are removed, since the records carry
+// their own.  A message starting with the name or code of a level, as in
+// "[WARN] retrying" or "error: closed", is logged at that level, without it.
+// The source of the records is the caller of the log package.
+func NewStdLogWriter(logger *Logger, lvl Level) io.Writer {
+	return &stdLogWriter{log: logger, lvl: lvl}
+}
+
+// NewStdLogger returns a standard library *log.Logger writing through logger
+// at lvl, see NewStdLogWriter.  It can be handed to the packages which only
+// accept a *log.Logger, e.g. as http.Server.ErrorLog.
+func NewStdLogger(logger *Logger, lvl Level) *stdlog.Logger {
+	return stdlog.New(NewStdLogWriter(logger, lvl), "", 0)
+}
+
+// RedirectStdLog sends the output of the standard log package (log.Printf...)
+// to logger at lvl, see NewStdLogWriter, and clears its flags.  Returns a
+// function restoring the previous output and flags.
+func RedirectStdLog(logger *Logger, lvl Level) func() {
+	flags, out := stdlog.Flags(), stdlog.Writer()
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(NewStdLogWriter(logger, lvl))
+	return func() {
+		stdlog.SetFlags(flags)
+		stdlog.SetOutput(out)
+	}
+}
+
+// This is the stdLogWriter's output method.  The log package writes one
+// message per call.
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	lvl, msg := w.parse(string(p))
+
+	// Determine if any logging will be done
+	write, parts := w.log.wants(lvl)
+	if !write {
+		return len(p), nil
+	}
+
+	// Make the log record and dispatch it
+	w.log.emit(w.log.newRecord(lvl, parts, msg, nil, callSite{skip: 1, trim: stdLogFrames}))
+	return len(p), nil
+}
+
+// Drop the frames of the log package, so that the records are attributed to
+// its caller.
+func stdLogFrames(frames []runtime.Frame) []runtime.Frame {
+	for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "log.") {
+		frames = frames[1:]
+	}
+	return frames
+}
+
+// Return the level and message of a line written by the log package.
+func (w *stdLogWriter) parse(line string) (Level, string) {
+	line = strings.TrimSuffix(line, "\n")
+	line = line[len(stdLogHeader.FindString(line)):]
+
+	if m := stdLogLevel.FindStringSubmatch(line); m != nil {
+		if lvl, ok := levelNamed(m[2] + m[3]); ok {
+			return lvl, line[len(m[0]):]
+		}
+	}
+	return w.lvl, line
+}
@@ -0,0 +1,104 @@
+/* termination.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+import (
+	"os"
+	"time"
+)
+
+// A TerminationPolicy tells how the program is ended by Fatal, Exit, Crash,
+// Recover and configuration errors.  Tests can intercept the termination by
+// replacing Exit and Panic; the callers return if these functions do.
+type TerminationPolicy struct {
+	Exit         func(code int)      // ends the program, nil for os.Exit
+	Panic        func(v interface{}) // panics with v, nil for panic
+	ExitCode     int                 // code of Fatal and configuration errors
+	FlushTimeout time.Duration       // how long the writers are waited for, 0 for no limit
+}
+
+// DefaultTerminationPolicy is the policy of the Loggers which have none.
+var DefaultTerminationPolicy = TerminationPolicy{
+	ExitCode:     1,
+	FlushTimeout: 5 * time.Second,
+}
+
+// SetTerminationPolicy sets how the Logger ends the program.  A named logger
+// without a policy uses its parent's, and a root logger without one uses
+// DefaultTerminationPolicy.  A nil p restores this default.
+func (log *Logger) SetTerminationPolicy(p *TerminationPolicy) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if p != nil {
+		cp := *p
+		p = &cp
+	}
+	log.termination = p
+}
+
+// TerminationPolicy returns the policy the Logger ends the program with.
+func (log *Logger) TerminationPolicy() TerminationPolicy {
+	for l := log; l != nil; l = l.parent {
+		l.mu.RLock()
+		p := l.termination
+		l.mu.RUnlock()
+		if p != nil {
+			return *p
+		}
+	}
+	return DefaultTerminationPolicy
+}
+
+// Close the writers of the Logger, waiting for them up to the FlushTimeout,
+// and end the program with code.
+func (log *Logger) exit(code int) {
+	p := log.TerminationPolicy()
+	log.closeWithin(p.FlushTimeout)
+	if p.Exit != nil {
+		p.Exit(code)
+	} else {
+		os.Exit(code)
+	}
+}
+
+// Close the writers of the Logger, waiting for them up to the FlushTimeout,
+// and panic with v.
+func (log *Logger) crash(v interface{}) {
+	p := log.TerminationPolicy()
+	log.closeWithin(p.FlushTimeout)
+	if p.Panic != nil {
+		p.Panic(v)
+	} else {
+		panic(v)
+	}
+}
+
+// End the program with the ExitCode of the policy, after a configuration
+// error reported to the ErrorHandler.
+func (log *Logger) fatalError() {
+	log.exit(log.TerminationPolicy().ExitCode)
+}
+
+// Close the Logger, giving up waiting for its writers after timeout (if
+// positive).
+func (log *Logger) closeWithin(timeout time.Duration) {
+	done := make(chan bool)
+	go func() {
+		log.Close()
+		close(done)
+	}()
+
+	if timeout <= 0 {
+		<-done
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
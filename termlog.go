@@ -9,7 +9,6 @@
 package log4go
 
 import (
-	"fmt"
 	"io"
 	"os"
 )
@@ -18,38 +17,62 @@ var stdout io.Writer = os.Stdout
 
 // This is the standard writer that prints to standard output.
 type ConsoleLogWriter struct {
-	recordsChan chan *LogRecord
-	format      string
+	recordQueue
+	pattern *Pattern
 }
 
 // This creates a new ConsoleLogWriter
 func NewConsoleLogWriter() *ConsoleLogWriter {
 	clw := ConsoleLogWriter{
-		format: "[%D %T] [%L] (%S) %M",
+		recordQueue: newRecordQueue(LogBufferLength),
+		pattern:     MustCompilePattern(FORMAT_DEFAULT),
 	}
-	clw.recordsChan = make(chan *LogRecord, LogBufferLength)
 	go clw.run(stdout)
 	return &clw
 }
 
+// Set the logging format.  An invalid format is reported to the writer's
+// ErrorHandler, and its invalid codes are ignored.  Must be called before the
+// first log message is written.
 func (w *ConsoleLogWriter) SetFormat(format string) {
-	w.format = format
+	p, err := compilePattern(format)
+	if err != nil {
+		w.reportError("ConsoleLogWriter", "format", err, nil)
+	}
+	w.pattern = p
+}
+
+// Set the compiled logging format.  Must be called before the first log
+// message is written.
+func (w *ConsoleLogWriter) SetPattern(p *Pattern) {
+	w.pattern = p
+}
+
+// RecordParts reports the costly record parts used by the format.
+func (w *ConsoleLogWriter) RecordParts() RecordPart {
+	return w.pattern.parts
 }
 
 func (w *ConsoleLogWriter) run(out io.Writer) {
-	for rec := range w.recordsChan {
-		fmt.Fprint(out, FormatLogRecord(w.format, rec))
-	}
+	defer close(w.done)
+	w.serve(func(rec *LogRecord) error {
+		buf := getBuffer()
+		w.pattern.write(buf, rec)
+		out.Write(buf.Bytes())
+		putBuffer(buf)
+		return nil
+	}, nil)
 }
 
-// This is the ConsoleLogWriter's output method.  This will block if the output
-// buffer is full.
+// This is the ConsoleLogWriter's output method.  If the output buffer is full
+// this blocks or drops a record, see SetOverflowPolicy.
 func (w *ConsoleLogWriter) LogWrite(rec *LogRecord) {
-	w.recordsChan <- rec
+	w.put(rec)
 }
 
-// Close stops the logger from sending messages to standard output.  Attempts to
-// send log messages to this logger after a Close have undefined behavior.
+// Close stops the logger from sending messages to standard output, once the
+// buffered messages have been written.  Attempts to send log messages to this
+// logger after a Close have undefined behavior.
 func (w *ConsoleLogWriter) Close() {
-	close(w.recordsChan)
+	w.close()
 }
@@ -0,0 +1,44 @@
+/* wrapped.go
+ *
+ * This software may be modified and distributed under the terms
+ * of the New BSD license.  See the LICENSE file for details.
+ */
+package log4go
+
+// The LogWriter wrapped by another, e.g. by a SamplingLogWriter.  Embedding it
+// passes Flush, WriterStats, the Logger's ErrorHandler and RecordParts on to
+// the wrapped LogWriter.
+type wrappedWriter struct {
+	writer LogWriter
+	parts  RecordPart // used by the wrapping LogWriter itself
+}
+
+// Flush flushes the wrapped LogWriter, if it is a Flusher.
+func (w *wrappedWriter) Flush() {
+	if f, ok := w.writer.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// WriterStats returns the counters of the wrapped LogWriter, if it has any.
+func (w *wrappedWriter) WriterStats() WriterStats {
+	if sw, ok := w.writer.(StatsLogWriter); ok {
+		return sw.WriterStats()
+	}
+	return WriterStats{}
+}
+
+func (w *wrappedWriter) setLoggerErrorHandler(h ErrorHandler) {
+	if ew, ok := w.writer.(errorHandlerSetter); ok {
+		ew.setLoggerErrorHandler(h)
+	}
+}
+
+// RecordParts reports the record parts used by the wrapped LogWriter and by
+// the wrapping one.
+func (w *wrappedWriter) RecordParts() RecordPart {
+	if pw, ok := w.writer.(PartialLogWriter); ok {
+		return pw.RecordParts() | w.parts
+	}
+	return PART_DEFAULT | w.parts
+}
@@ -11,14 +11,15 @@
 package log4go
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 )
 
 var (
-	Global Logger
+	Global *Logger
 )
 
 func init() {
@@ -38,105 +39,132 @@ func LoadConfiguration(filename string) {
 }
 
 // AddFilter Wrapper for (*Logger).AddFilter
-func AddFilter(name string, lvl level, writer LogWriter) {
+func AddFilter(name string, lvl Level, writer LogWriter) {
 	Global.AddFilter(name, lvl, writer)
 }
 
+// SetLevel Wrapper for (*Logger).SetLevel
+func SetLevel(name string, lvl Level) bool {
+	return Global.SetLevel(name, lvl)
+}
+
+// AddHook Wrapper for (*Logger).AddHook
+func AddHook(name string, order int, h Hook) {
+	Global.AddHook(name, order, h)
+}
+
+// RemoveHook Wrapper for (*Logger).RemoveHook
+func RemoveHook(name string) bool {
+	return Global.RemoveHook(name)
+}
+
+// SetTerminationPolicy Wrapper for (*Logger).SetTerminationPolicy
+func SetTerminationPolicy(p *TerminationPolicy) {
+	Global.SetTerminationPolicy(p)
+}
+
 // Close Wrapper for (*Logger).Close (closes and removes all logwriters)
 func Close() {
 	Global.Close()
 }
 
-// Crash Logs the given message and crashes the program
+// Flush Wrapper for (*Logger).Flush (waits for the logwriters to write their records)
+func Flush(timeout time.Duration) error {
+	return Global.Flush(timeout)
+}
+
+// Crash Logs the given message with a stack trace and crashes the program
+// (see SetTerminationPolicy)
 func Crash(args ...interface{}) {
-	format := format(len(args))
-	err := Global.Critical(format, args)
-	Global.Close()
-	panic(err)
+	msg := fmt.Sprintf(format(len(args)), args...)
+	Global.output(CallerDepth, nil, CRITICAL, nil, true, msg)
+	Global.crash(errors.New(msg))
 }
 
-// Crashf Logs the given message and crashes the program
+// Crashf Logs the given message with a stack trace and crashes the program
+// (see SetTerminationPolicy)
 func Crashf(format string, args ...interface{}) {
-	Global.intLog(CRITICAL, format, args...)
-	Global.Close() // so that hopefully the messages get logged
-	panic(fmt.Sprintf(format, args...))
+	Global.output(CallerDepth, nil, CRITICAL, nil, true, format, args...)
+	Global.crash(fmt.Sprintf(format, args...))
 }
 
 // Fatalf Compatibility with `log`
 func Fatalf(format string, args ...interface{}) {
-	Fatal(format, args)
+	Global.intLog(nil, CRITICAL, nil, format, args...)
+	Global.exit(Global.TerminationPolicy().ExitCode)
 }
 
 // Fatalln Compatibility with `log`
 func Fatalln(args ...interface{}) {
-	Fatal(args)
+	if len(args) > 0 {
+		Global.intLog(nil, CRITICAL, nil, format(len(args)), args...)
+	}
+	Global.exit(Global.TerminationPolicy().ExitCode)
 }
 
-// Fatal Compatibility with `log`
+// Fatal Compatibility with `log`; exits with the ExitCode of the
+// TerminationPolicy of Global
 func Fatal(args ...interface{}) {
 	if len(args) > 0 {
-		Global.Critical(format(len(args)), args...)
+		Global.intLog(nil, CRITICAL, nil, format(len(args)), args...)
 	}
-	Global.Close()
-	os.Exit(1)
+	Global.exit(Global.TerminationPolicy().ExitCode)
 }
 
 // Exit Compatibility with `log`
 func Exit(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLog(ERROR, format(len(args)), args...)
+		Global.intLog(nil, ERROR, nil, format(len(args)), args...)
 	}
-	Global.Close() // so that hopefully the messages get logged
-	os.Exit(0)
+	Global.exit(0)
 }
 
 // Exitf Compatibility with `log`
 func Exitf(format string, args ...interface{}) {
-	Global.intLog(ERROR, format, args...)
-	Global.Close() // so that hopefully the messages get logged
-	os.Exit(0)
+	Global.intLog(nil, ERROR, nil, format, args...)
+	Global.exit(0)
 }
 
 // Stderr Compatibility with `log`
 func Stderr(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLog(ERROR, format(len(args)), args...)
+		Global.intLog(nil, ERROR, nil, format(len(args)), args...)
 	}
 }
 
 // Stderrf Compatibility with `log`
 func Stderrf(format string, args ...interface{}) {
-	Global.intLog(ERROR, format, args...)
+	Global.intLog(nil, ERROR, nil, format, args...)
 }
 
 // Stdout Compatibility with `log`
 func Stdout(args ...interface{}) {
 	if len(args) > 0 {
-		Global.intLog(INFO, format(len(args)), args...)
+		Global.intLog(nil, INFO, nil, format(len(args)), args...)
 	}
 }
 
 // Stdoutf Compatibility with `log`
 func Stdoutf(format string, args ...interface{}) {
-	Global.intLog(INFO, format, args...)
+	Global.intLog(nil, INFO, nil, format, args...)
 }
 
 // Log Send a log message manually
 // Wrapper for (*Logger).Log
-func Log(lvl level, source, message string) {
+func Log(lvl Level, source, message string) {
 	Global.Log(lvl, source, message)
 }
 
 // Logf Send a formatted log message easily
 // Wrapper for (*Logger).Logf
-func Logf(lvl level, format string, args ...interface{}) {
-	Global.intLog(lvl, format, args...)
+func Logf(lvl Level, format string, args ...interface{}) {
+	Global.intLog(nil, lvl, nil, format, args...)
 }
 
 // Logc Send a closure log message
 // Wrapper for (*Logger).Logc
-func Logc(lvl level, closure func() string) {
-	Global.intLog(lvl, closure)
+func Logc(lvl Level, closure func() string) {
+	Global.intLog(nil, lvl, nil, closure)
 }
 
 // Finest Utility for finest log messages (see Debug() for parameter explanation)
@@ -148,13 +176,13 @@ func Finest(arg0 interface{}, args ...interface{}) {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
-		Global.intLog(lvl, first)
+		Global.intLog(nil, lvl, nil, first)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
 	}
 }
 
@@ -167,13 +195,13 @@ func Fine(arg0 interface{}, args ...interface{}) {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
-		Global.intLog(lvl, first)
+		Global.intLog(nil, lvl, nil, first)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
 	}
 }
 
@@ -189,13 +217,13 @@ func Debug(arg0 interface{}, args ...interface{}) {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
-		Global.intLog(lvl, first)
+		Global.intLog(nil, lvl, nil, first)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
 	}
 }
 
@@ -208,13 +236,13 @@ func Trace(arg0 interface{}, args ...interface{}) {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
-		Global.intLog(lvl, first)
+		Global.intLog(nil, lvl, nil, first)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
 	}
 }
 
@@ -227,13 +255,13 @@ func Info(arg0 interface{}, args ...interface{}) {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
-		Global.intLog(lvl, first)
+		Global.intLog(nil, lvl, nil, first)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
 	}
 }
 
@@ -247,19 +275,18 @@ func Warn(arg0 interface{}, args ...interface{}) error {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 		return fmt.Errorf(first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
 		str := first()
-		Global.intLog(lvl, "%s", str)
+		Global.intLog(nil, lvl, nil, "%s", str)
 		return errors.New(str)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
 	}
-	return nil
 }
 
 // Error Utility for error log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
@@ -272,24 +299,133 @@ func Error(arg0 interface{}, args ...interface{}) error {
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
-		Global.intLog(lvl, first, args...)
+		Global.intLog(nil, lvl, nil, first, args...)
 		return fmt.Errorf(first, args...)
 	case func() string:
 		// Log the closure (no other arguments used)
 		str := first()
-		Global.intLog(lvl, "%s", str)
+		Global.intLog(nil, lvl, nil, "%s", str)
 		return errors.New(str)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLog(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLog(nil, lvl, nil, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
 	}
-	return nil
 }
 
 // Critical Utility for critical log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
 // These functions will execute a closure exactly once, to build the error message for the return
 // Wrapper for (*Logger).Critical
 func Critical(arg0 interface{}, args ...interface{}) error {
-	return Global.Critical(arg0, args)
+	return Global.intLog(nil, CRITICAL, nil, arg0, args...)
+}
+
+// With returns a FieldLogger writing through Global with the given alternating
+// keys and values attached to every record.
+// Wrapper for (*Logger).With
+func With(kv ...interface{}) *FieldLogger {
+	return Global.With(kv...)
+}
+
+// Finestw Utility for finest log messages with fields (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Finestw
+func Finestw(msg string, kv ...interface{}) {
+	Global.intLog(nil, FINEST, kvToFields(kv), msg)
+}
+
+// Finew Utility for fine log messages with fields (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Finew
+func Finew(msg string, kv ...interface{}) {
+	Global.intLog(nil, FINE, kvToFields(kv), msg)
+}
+
+// Debugw Utility for debug log messages with fields
+// The message is logged as is and the remaining arguments are alternating keys and values attached to the record.
+// Wrapper for (*Logger).Debugw
+func Debugw(msg string, kv ...interface{}) {
+	Global.intLog(nil, DEBUG, kvToFields(kv), msg)
+}
+
+// Tracew Utility for trace log messages with fields (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Tracew
+func Tracew(msg string, kv ...interface{}) {
+	Global.intLog(nil, TRACE, kvToFields(kv), msg)
+}
+
+// Infow Utility for info log messages with fields (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Infow
+func Infow(msg string, kv ...interface{}) {
+	Global.intLog(nil, INFO, kvToFields(kv), msg)
+}
+
+// Warnw Utility for warn log messages with fields (returns an error for easy function returns) (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Warnw
+func Warnw(msg string, kv ...interface{}) error {
+	return Global.intLog(nil, WARNING, kvToFields(kv), msg)
+}
+
+// Errorw Utility for error log messages with fields (returns an error for easy function returns) (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Errorw
+func Errorw(msg string, kv ...interface{}) error {
+	return Global.intLog(nil, ERROR, kvToFields(kv), msg)
+}
+
+// Criticalw Utility for critical log messages with fields (returns an error for easy function returns) (see Debugw() for parameter explanation)
+// Wrapper for (*Logger).Criticalw
+func Criticalw(msg string, kv ...interface{}) error {
+	return Global.intLog(nil, CRITICAL, kvToFields(kv), msg)
+}
+
+// FinestCtx Utility for finest log messages carrying the fields found in ctx (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).FinestCtx
+func FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLog(ctx, FINEST, nil, arg0, args...)
+}
+
+// FineCtx Utility for fine log messages carrying the fields found in ctx (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).FineCtx
+func FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLog(ctx, FINE, nil, arg0, args...)
+}
+
+// DebugCtx Utility for debug log messages carrying the fields found in ctx by the registered ContextExtractors (see Debug() for the remaining parameters)
+// Wrapper for (*Logger).DebugCtx
+func DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLog(ctx, DEBUG, nil, arg0, args...)
+}
+
+// TraceCtx Utility for trace log messages carrying the fields found in ctx (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).TraceCtx
+func TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLog(ctx, TRACE, nil, arg0, args...)
+}
+
+// InfoCtx Utility for info log messages carrying the fields found in ctx (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).InfoCtx
+func InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	Global.intLog(ctx, INFO, nil, arg0, args...)
+}
+
+// WarnCtx Utility for warning log messages carrying the fields found in ctx (returns an error for easy function returns) (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).WarnCtx
+func WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return Global.intLog(ctx, WARNING, nil, arg0, args...)
+}
+
+// ErrorCtx Utility for error log messages carrying the fields found in ctx (returns an error for easy function returns) (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).ErrorCtx
+func ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return Global.intLog(ctx, ERROR, nil, arg0, args...)
+}
+
+// CriticalCtx Utility for critical log messages carrying the fields found in ctx (returns an error for easy function returns) (see DebugCtx() for parameter explanation)
+// Wrapper for (*Logger).CriticalCtx
+func CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	return Global.intLog(ctx, CRITICAL, nil, arg0, args...)
+}
+
+// GetLogger returns the named logger below Global
+// Wrapper for (*Logger).GetLogger
+func GetLogger(name string) *Logger {
+	return Global.GetLogger(name)
 }